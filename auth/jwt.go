@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var ErrMissingToken = errors.New("missing authorization token")
+
+// Claims son los datos del token que quedan disponibles para los controladores
+type Claims struct {
+	Roles []string `json:"roles,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// ParseToken valida un token HS256 firmado con secret. El token debe tener
+// "exp" para que uno filtrado no sirva para siempre. Acepta el token con o sin
+// el prefijo "Bearer ".
+func ParseToken(tokenString string, secret []byte) (*Claims, error) {
+	tokenString = strings.TrimSpace(tokenString)
+	if len(tokenString) > 7 && strings.EqualFold(tokenString[:7], "Bearer ") {
+		tokenString = strings.TrimSpace(tokenString[7:])
+	}
+	if tokenString == "" {
+		return nil, ErrMissingToken
+	}
+	if len(secret) == 0 {
+		return nil, errors.New("JWT_SECRET is not configured")
+	}
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return secret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+type claimsKey struct{}
+
+// NewContext devuelve una copia de ctx con los claims del usuario autenticado
+func NewContext(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, claimsKey{}, claims)
+}
+
+// FromContext devuelve los claims guardados en ctx, si la petición fue autenticada
+func FromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(*Claims)
+	return claims, ok
+}
@@ -0,0 +1,8 @@
+package config
+
+import "os"
+
+// JWTSecret es la clave con la que se firman los tokens HS256
+func JWTSecret() []byte {
+	return []byte(os.Getenv("JWT_SECRET"))
+}
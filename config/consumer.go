@@ -0,0 +1,140 @@
+package config
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Nombre de la cola de la que consume el servicio
+const ProductQueue = "product"
+
+// Políticas para mensajes cuyo sobre no se puede decodificar
+const (
+	MalformedAck    = "ack"    // Se confirma y se descarta el mensaje
+	MalformedReject = "reject" // Se rechaza sin reencolar (termina en la DLQ)
+)
+
+// MalformedMessagePolicy lee MALFORMED_MESSAGE_POLICY, por defecto "reject"
+func MalformedMessagePolicy() string {
+	policy := strings.ToLower(os.Getenv("MALFORMED_MESSAGE_POLICY"))
+	switch policy {
+	case MalformedAck, MalformedReject:
+		return policy
+	case "":
+		return MalformedReject
+	default:
+		log.Printf("Unknown MALFORMED_MESSAGE_POLICY %q, using %q", policy, MalformedReject)
+		return MalformedReject
+	}
+}
+
+// Políticas para respuestas que RabbitMQ no confirmó o no pudo enrutar
+const (
+	ReplyFailureLog        = "log"   // Se registra y se confirma la petición igualmente
+	ReplyFailureRetry      = "retry" // Se reintenta publicar la respuesta hasta MAX_DELIVERY_ATTEMPTS veces y luego la petición va a la DLQ
+	ReplyFailureDeadLetter = "dlq"   // Se envía la petición directamente a la DLQ
+)
+
+// ReplyFailurePolicy lee REPLY_FAILURE_POLICY, por defecto "retry"
+func ReplyFailurePolicy() string {
+	policy := strings.ToLower(os.Getenv("REPLY_FAILURE_POLICY"))
+	switch policy {
+	case ReplyFailureLog, ReplyFailureRetry, ReplyFailureDeadLetter:
+		return policy
+	case "":
+		return ReplyFailureRetry
+	default:
+		log.Printf("Unknown REPLY_FAILURE_POLICY %q, using %q", policy, ReplyFailureRetry)
+		return ReplyFailureRetry
+	}
+}
+
+// DeadLetterExchange es el exchange al que RabbitMQ envía los mensajes rechazados
+func DeadLetterExchange() string {
+	return getEnv("DEAD_LETTER_EXCHANGE", "product.dlx")
+}
+
+// DeadLetterQueue es la cola donde quedan los mensajes rechazados para inspeccionarlos o reenviarlos
+func DeadLetterQueue() string {
+	return getEnv("DEAD_LETTER_QUEUE", "product.dlq")
+}
+
+// MaxDeliveryAttempts es el número de intentos antes de enviar un mensaje a la DLQ
+func MaxDeliveryAttempts() int {
+	return getEnvInt("MAX_DELIVERY_ATTEMPTS", 3)
+}
+
+// RetryQueue es la cola donde esperan los mensajes que se van a reintentar.
+// Cuando vence la espera RabbitMQ los devuelve a ProductQueue.
+func RetryQueue() string {
+	return getEnv("RETRY_QUEUE", "product.retry")
+}
+
+// RetryBackoff es la espera antes del primer reintento de un mensaje; se duplica en cada intento
+func RetryBackoff() time.Duration {
+	return getEnvDuration("RETRY_BACKOFF", time.Second)
+}
+
+// RetryMaxBackoff es la espera máxima antes de reintentar un mensaje
+func RetryMaxBackoff() time.Duration {
+	return getEnvDuration("RETRY_MAX_BACKOFF", 30*time.Second)
+}
+
+// ShutdownTimeout es el tiempo máximo que se espera a que terminen los mensajes en proceso al apagar el servicio
+func ShutdownTimeout() time.Duration {
+	return getEnvDuration("SHUTDOWN_TIMEOUT", 30*time.Second)
+}
+
+// ReconnectMaxBackoff es la espera máxima entre intentos de reconexión con RabbitMQ
+func ReconnectMaxBackoff() time.Duration {
+	return getEnvDuration("RABBITMQ_RECONNECT_MAX_BACKOFF", 30*time.Second)
+}
+
+func getEnv(key string, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func getEnvInt(key string, fallback int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		log.Printf("Invalid %s %q, using %d", key, value, fallback)
+		return fallback
+	}
+	return n
+}
+
+// ConsumerWorkers es el número de goroutines que procesan mensajes en paralelo
+func ConsumerWorkers() int {
+	return getEnvInt("CONSUMER_WORKERS", 4)
+}
+
+// PrefetchCount es el número de mensajes sin confirmar que RabbitMQ entrega al
+// consumidor. Por defecto uno por worker, para que ninguno quede ocioso.
+func PrefetchCount() int {
+	return getEnvInt("PREFETCH_COUNT", ConsumerWorkers())
+}
+
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		log.Printf("Invalid %s %q, using %s", key, value, fallback)
+		return fallback
+	}
+	return d
+}
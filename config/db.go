@@ -1,37 +1,149 @@
 package config
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
+	"log"
 	"os"
-	
-	"github.com/FelipeGeraldoblufus/product-microservice-go/models"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
 var DB *gorm.DB
 
+// DBMaxOpenConns es el máximo de conexiones abiertas con Postgres
+func DBMaxOpenConns() int {
+	return getEnvInt("DB_MAX_OPEN_CONNS", 25)
+}
+
+// DBMaxIdleConns es el máximo de conexiones inactivas que se mantienen en el pool
+func DBMaxIdleConns() int {
+	return getEnvInt("DB_MAX_IDLE_CONNS", 5)
+}
+
+// DBConnMaxLifetime es cuánto tiempo se reutiliza una conexión antes de cerrarla
+func DBConnMaxLifetime() time.Duration {
+	return getEnvDuration("DB_CONN_MAX_LIFETIME", 30*time.Minute)
+}
+
+// DBConnMaxIdleTime es cuánto tiempo puede quedar inactiva una conexión antes de cerrarla
+func DBConnMaxIdleTime() time.Duration {
+	return getEnvDuration("DB_CONN_MAX_IDLE_TIME", 5*time.Minute)
+}
+
+// DBStatementTimeout es el statement_timeout de Postgres para cada conexión
+func DBStatementTimeout() time.Duration {
+	return getEnvDuration("DB_STATEMENT_TIMEOUT", 30*time.Second)
+}
+
+// DBConnectAttempts es cuántas veces se intenta conectar al arrancar antes de fallar
+func DBConnectAttempts() int {
+	return getEnvInt("DB_CONNECT_ATTEMPTS", 10)
+}
+
+// DBConnectMaxBackoff es la espera máxima entre intentos de conexión al arrancar
+func DBConnectMaxBackoff() time.Duration {
+	return getEnvDuration("DB_CONNECT_MAX_BACKOFF", 30*time.Second)
+}
+
+// SetupDatabase conecta con Postgres. Si no responde lo reintenta con espera
+// exponencial hasta DB_CONNECT_ATTEMPTS veces, útil cuando Postgres arranca a
+// la vez que el servicio.
 func SetupDatabase() {
 	var dbURL = os.Getenv("DB_URL")
 	if dbURL == "" {
 		panic("DB_URL environment variable missing")
 	}
 
-	var err error
-	DB, err = gorm.Open(postgres.Open(dbURL), &gorm.Config{})
+	connConfig, err := pgx.ParseConfig(dbURL)
+	if err != nil {
+		panic(fmt.Errorf("invalid DB_URL: %w", err))
+	}
+	connConfig.RuntimeParams["statement_timeout"] = strconv.FormatInt(DBStatementTimeout().Milliseconds(), 10)
+
+	attempts := DBConnectAttempts()
+	backoff := time.Second
+	maxBackoff := DBConnectMaxBackoff()
+	for attempt := 1; ; attempt++ {
+		DB, err = openDatabase(connConfig)
+		if err == nil {
+			break
+		}
+		if attempt >= attempts {
+			panic(err)
+		}
+
+		log.Printf("Failed to connect to database (attempt %d/%d): %v. Retrying in %s...", attempt, attempts, err, backoff)
+		time.Sleep(backoff)
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
 
+	fmt.Println("Connected to database")
+}
+
+// openDatabase abre el pool con la configuración de DB_* y comprueba la conexión
+func openDatabase(connConfig *pgx.ConnConfig) (*gorm.DB, error) {
+	sqlDB := stdlib.OpenDB(*connConfig)
+	sqlDB.SetMaxOpenConns(DBMaxOpenConns())
+	sqlDB.SetMaxIdleConns(DBMaxIdleConns())
+	sqlDB.SetConnMaxLifetime(DBConnMaxLifetime())
+	sqlDB.SetConnMaxIdleTime(DBConnMaxIdleTime())
+
+	connection, err := gorm.Open(postgres.New(postgres.Config{Conn: sqlDB}), &gorm.Config{})
 	if err != nil {
-		panic(err)
-	} else {
-		fmt.Println("Connected to database")
+		sqlDB.Close()
+		return nil, err
 	}
+	return connection, nil
+}
 
-	autoMigrate(DB)
+// DatabaseStats devuelve las estadísticas del pool de conexiones, para monitoreo
+func DatabaseStats() (sql.DBStats, error) {
+	if DB == nil {
+		return sql.DBStats{}, fmt.Errorf("database not configured")
+	}
 
+	sqlDB, err := DB.DB()
+	if err != nil {
+		return sql.DBStats{}, err
+	}
+	return sqlDB.Stats(), nil
 }
 
-func autoMigrate(connection *gorm.DB) {
-	connection.Debug().AutoMigrate(&models.Product{})
-	connection.Debug().AutoMigrate(&models.User{})
-	
-}
\ No newline at end of file
+// PingDatabase comprueba que Postgres responde, útil para health checks
+func PingDatabase(ctx context.Context) error {
+	if DB == nil {
+		return fmt.Errorf("database not configured")
+	}
+
+	sqlDB, err := DB.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
+
+// CloseDatabase cierra el pool de conexiones de la base de datos
+func CloseDatabase() {
+	if DB == nil {
+		return
+	}
+
+	sqlDB, err := DB.DB()
+	if err != nil {
+		fmt.Println("Failed to get database pool:", err)
+		return
+	}
+	if err := sqlDB.Close(); err != nil {
+		fmt.Println("Failed to close database:", err)
+	}
+}
@@ -0,0 +1,6 @@
+package config
+
+// HTTPPort es el puerto de la API REST
+func HTTPPort() string {
+	return getEnv("PORT", "8080")
+}
@@ -0,0 +1,23 @@
+package config
+
+import (
+	"log"
+	"os"
+	"strings"
+
+	"github.com/FelipeGeraldoblufus/product-microservice-go/models"
+)
+
+// DefaultCurrency lee DEFAULT_CURRENCY, por defecto "CLP". Se usa cuando un
+// producto se crea sin moneda y para migrar los precios existentes.
+func DefaultCurrency() string {
+	currency := strings.ToUpper(os.Getenv("DEFAULT_CURRENCY"))
+	if currency == "" {
+		return "CLP"
+	}
+	if _, ok := models.CurrencyExponent(currency); !ok {
+		log.Printf("Unsupported DEFAULT_CURRENCY %q, using %q", currency, "CLP")
+		return "CLP"
+	}
+	return currency
+}
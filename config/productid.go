@@ -0,0 +1,23 @@
+package config
+
+import (
+	"log"
+	"os"
+	"strings"
+
+	"github.com/FelipeGeraldoblufus/product-microservice-go/models"
+)
+
+// ProductIDScheme lee PRODUCT_ID_SCHEME ("uuidv7" o "ulid"), por defecto "uuidv7"
+func ProductIDScheme() string {
+	scheme := strings.ToLower(os.Getenv("PRODUCT_ID_SCHEME"))
+	switch scheme {
+	case "":
+		return models.ProductIDUUIDv7
+	case models.ProductIDUUIDv7, models.ProductIDULID:
+		return scheme
+	default:
+		log.Printf("Unsupported PRODUCT_ID_SCHEME %q, using %q", scheme, models.ProductIDUUIDv7)
+		return models.ProductIDUUIDv7
+	}
+}
@@ -1,8 +1,12 @@
 package config
 
 import (
+	"context"
+	"errors"
 	"log"
 	"os"
+	"sync"
+	"time"
 
 	amqp "github.com/rabbitmq/amqp091-go"
 )
@@ -13,29 +17,166 @@ func failOnError(err error, msg string) {
 	}
 }
 
-var ch *amqp.Channel
-var conn *amqp.Connection
+// Estados de la conexión con RabbitMQ
+const (
+	StateConnected    = "connected"
+	StateReconnecting = "reconnecting"
+	StateClosed       = "closed"
+)
+
+var (
+	mu     sync.RWMutex
+	ch     *amqp.Channel
+	pubCh  *amqp.Channel
+	conn   *amqp.Connection
+	state  = StateClosed
+	closed chan *amqp.Error
+)
 
 func SetupRabbitMQ() {
+	err := connect()
+	failOnError(err, "Failed to connect to RabbitMQ")
+}
+
+// connect abre la conexión y los canales, y empieza a vigilar su cierre
+func connect() error {
 	URL := os.Getenv("RABBITMQ_URL")
 	if URL == "" {
-		failOnError(nil, "Failed to get RabbitMQ URL")
+		return errors.New("RABBITMQ_URL environment variable missing")
 	}
 
 	//fmt.Println(URL)
-	conn, err := amqp.Dial(URL) //Establecer una conexion con el servidor de rabbitmq
-	failOnError(err, "Failed to connect to RabbitMQ")
+	newConn, err := amqp.Dial(URL) //Establecer una conexion con el servidor de rabbitmq
+	if err != nil {
+		return err
+	}
+
+	newCh, err := newConn.Channel() //Sesion o instancia de comunicacion con el servidor de rabbitmq
+	if err != nil {
+		newConn.Close()
+		return err
+	}
+
+	// Canal separado para publicar respuestas, el de consumo solo recibe y confirma
+	newPubCh, err := newConn.Channel()
+	if err != nil {
+		newConn.Close()
+		return err
+	}
 
-	ch, err = conn.Channel() //Sesion o instancia de comunicacion con el servidor de rabbitmq
-	failOnError(err, "Failed to open a channel")
+	// Modo confirm: RabbitMQ confirma cada mensaje publicado por este canal
+	if err := newPubCh.Confirm(false); err != nil {
+		newConn.Close()
+		return err
+	}
+
+	mu.Lock()
+	conn, ch, pubCh = newConn, newCh, newPubCh
+	closed = watchClose(newConn, newCh, newPubCh)
+	state = StateConnected
+	mu.Unlock()
 
+	return nil
+}
+
+// watchClose devuelve un canal que recibe un valor cuando se cierra la
+// conexión o cualquiera de sus canales
+func watchClose(c *amqp.Connection, consumeCh *amqp.Channel, publishCh *amqp.Channel) chan *amqp.Error {
+	out := make(chan *amqp.Error, 1)
+
+	// RabbitMQ bloquea si nadie lee estas notificaciones, por eso llevan buffer
+	connClosed := c.NotifyClose(make(chan *amqp.Error, 1))
+	consumeClosed := consumeCh.NotifyClose(make(chan *amqp.Error, 1))
+	publishClosed := publishCh.NotifyClose(make(chan *amqp.Error, 1))
+
+	go func() {
+		var err *amqp.Error
+		select {
+		case err = <-connClosed:
+		case err = <-consumeClosed:
+		case err = <-publishClosed:
+		}
+		out <- err
+	}()
+
+	return out
+}
+
+// NotifyClosed devuelve un canal que recibe un valor cuando se pierde la
+// conexión actual con RabbitMQ. El error es nil si el cierre fue ordenado.
+func NotifyClosed() <-chan *amqp.Error {
+	mu.RLock()
+	defer mu.RUnlock()
+	return closed
+}
+
+// ReconnectRabbitMQ cierra lo que quede de la conexión anterior y vuelve a
+// conectar con backoff exponencial hasta conseguirlo o hasta que ctx se cancele.
+func ReconnectRabbitMQ(ctx context.Context) error {
+	mu.Lock()
+	state = StateReconnecting
+	if conn != nil {
+		conn.Close()
+	}
+	mu.Unlock()
+
+	backoff := time.Second
+	maxBackoff := ReconnectMaxBackoff()
+	for {
+		log.Printf("Reconnecting to RabbitMQ in %s...", backoff)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+
+		err := connect()
+		if err == nil {
+			log.Println("Reconnected to RabbitMQ")
+			return nil
+		}
+		log.Printf("Failed to reconnect to RabbitMQ: %v", err)
+
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// RabbitMQState devuelve el estado de la conexión, útil para health checks
+func RabbitMQState() string {
+	mu.RLock()
+	defer mu.RUnlock()
+	return state
 }
 
 func GetChannel() *amqp.Channel {
+	mu.RLock()
+	defer mu.RUnlock()
 	return ch
 }
 
+// GetPublishChannel devuelve el canal usado para publicar mensajes
+func GetPublishChannel() *amqp.Channel {
+	mu.RLock()
+	defer mu.RUnlock()
+	return pubCh
+}
+
+// CloseRabbitMQ cierra los canales y la conexión con RabbitMQ
 func CloseRabbitMQ() {
-	ch.Close()
-	conn.Close()
+	mu.Lock()
+	defer mu.Unlock()
+
+	state = StateClosed
+	if pubCh != nil {
+		pubCh.Close()
+	}
+	if ch != nil {
+		ch.Close()
+	}
+	if conn != nil {
+		conn.Close()
+	}
 }
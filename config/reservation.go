@@ -0,0 +1,13 @@
+package config
+
+import "time"
+
+// ReservationTTL es el tiempo que dura una reserva de stock sin confirmar
+func ReservationTTL() time.Duration {
+	return getEnvDuration("RESERVATION_TTL", 15*time.Minute)
+}
+
+// ReservationSweepInterval es cada cuánto se devuelven al stock las reservas vencidas
+func ReservationSweepInterval() time.Duration {
+	return getEnvDuration("RESERVATION_SWEEP_INTERVAL", time.Minute)
+}
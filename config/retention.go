@@ -0,0 +1,13 @@
+package config
+
+import "time"
+
+// ProductRetention es cuánto tiempo se conserva un producto borrado antes de eliminarlo definitivamente
+func ProductRetention() time.Duration {
+	return getEnvDuration("PRODUCT_RETENTION", 30*24*time.Hour)
+}
+
+// ProductPurgeInterval es cada cuánto se eliminan los productos borrados hace más de PRODUCT_RETENTION
+func ProductPurgeInterval() time.Duration {
+	return getEnvDuration("PRODUCT_PURGE_INTERVAL", time.Hour)
+}
@@ -0,0 +1,55 @@
+package config
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// Configuraciones de texto de Postgres aceptadas para la búsqueda
+var searchLanguages = map[string]bool{
+	"simple":     true,
+	"spanish":    true,
+	"english":    true,
+	"portuguese": true,
+	"french":     true,
+	"german":     true,
+	"italian":    true,
+}
+
+// SearchLanguage lee SEARCH_LANGUAGE, por defecto "spanish". Es la
+// configuración usada para el índice GIN de búsqueda.
+func SearchLanguage() string {
+	language := strings.ToLower(os.Getenv("SEARCH_LANGUAGE"))
+	if language == "" {
+		return "spanish"
+	}
+	if !IsSearchLanguage(language) {
+		log.Printf("Unknown SEARCH_LANGUAGE %q, using %q", language, "spanish")
+		return "spanish"
+	}
+	return language
+}
+
+// IsSearchLanguage indica si language es una configuración de búsqueda válida
+func IsSearchLanguage(language string) bool {
+	return searchLanguages[language]
+}
+
+// ProductSearchVector devuelve la expresión tsvector del nombre y la
+// descripción de un producto, con el nombre pesando más. El índice y las
+// consultas deben usar exactamente la misma expresión, por eso el idioma va
+// como literal; language debe haberse validado con IsSearchLanguage.
+func ProductSearchVector(language string) string {
+	return fmt.Sprintf(
+		"setweight(to_tsvector('%[1]s', coalesce(products.name, '')), 'A') || "+
+			"setweight(to_tsvector('%[1]s', coalesce(products.description, '')), 'C')",
+		language)
+}
+
+// CategorySearchVector devuelve la expresión tsvector del nombre de una
+// categoría, que pesa entre el nombre y la descripción del producto
+func CategorySearchVector(language string) string {
+	return fmt.Sprintf("setweight(to_tsvector('%s', coalesce(categories.name, '')), 'B')", language)
+}
@@ -0,0 +1,236 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/FelipeGeraldoblufus/product-microservice-go/models"
+	"gorm.io/gorm"
+)
+
+// findCategory busca una categoría por slug
+func findCategory(tx *gorm.DB, slug string) (models.Category, error) {
+	var category models.Category
+	if err := tx.Where("slug = ?", slug).First(&category).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return category, fmt.Errorf("category %q %w", slug, ErrNotFound)
+		}
+		return category, err
+	}
+	return category, nil
+}
+
+// resolveCategory busca una categoría por slug y, si no existe, por nombre.
+// Así siguen funcionando los clientes que envían el nombre de la categoría.
+func resolveCategory(tx *gorm.DB, ref string) (models.Category, error) {
+	category, err := findCategory(tx, ref)
+	if !errors.Is(err, ErrNotFound) {
+		return category, err
+	}
+
+	err = tx.Where("name = ?", ref).First(&category).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return category, fmt.Errorf("%w: category %q does not exist", ErrInvalid, ref)
+	}
+	return category, err
+}
+
+// categoryTreeIDs devuelve el ID de la categoría y los de todas sus descendientes
+func categoryTreeIDs(tx *gorm.DB, id uint) ([]uint, error) {
+	var ids []uint
+	err := tx.Raw(`WITH RECURSIVE tree AS (
+		SELECT id FROM categories WHERE id = ?
+		UNION
+		SELECT c.id FROM categories c JOIN tree t ON c.parent_id = t.id
+	) SELECT id FROM tree`, id).Scan(&ids).Error
+	return ids, err
+}
+
+// CategoryUpdate son los cambios de UpdateCategory. Los textos vacíos no
+// modifican el campo; Parent apuntando a "" convierte la categoría en raíz.
+type CategoryUpdate struct {
+	Name   string
+	Slug   string // Ya normalizado con models.Slugify
+	Parent *string
+}
+
+// CreateCategory crea una categoría. Si slug está vacío se genera a partir
+// del nombre; parentSlug vacío crea una categoría raíz.
+func (s *Service) CreateCategory(ctx context.Context, name string, slug string, parentSlug string) (models.Category, error) {
+	if name == "" {
+		return models.Category{}, fmt.Errorf("%w: category name cannot be empty", ErrInvalid)
+	}
+
+	category := models.Category{Name: name, Slug: models.Slugify(slug)}
+	if slug == "" {
+		category.Slug = models.Slugify(name)
+	}
+	if category.Slug == "" {
+		return models.Category{}, fmt.Errorf("%w: category slug cannot be empty", ErrInvalid)
+	}
+
+	if err := s.Categories.Create(ctx, &category, parentSlug); err != nil {
+		return models.Category{}, err
+	}
+	return category, nil
+}
+
+// ListCategories devuelve todas las categorías. Con tree devuelve solo las
+// raíces, cada una con sus subcategorías en Children.
+func (s *Service) ListCategories(ctx context.Context, tree bool) ([]models.Category, error) {
+	categories, err := s.Categories.List(ctx)
+	if err != nil || !tree {
+		return categories, err
+	}
+
+	byParent := make(map[uint][]models.Category)
+	var roots []models.Category
+	for _, category := range categories {
+		if category.ParentID == nil {
+			roots = append(roots, category)
+		} else {
+			byParent[*category.ParentID] = append(byParent[*category.ParentID], category)
+		}
+	}
+
+	var attach func(nodes []models.Category) []models.Category
+	attach = func(nodes []models.Category) []models.Category {
+		for i := range nodes {
+			nodes[i].Children = attach(byParent[nodes[i].ID])
+		}
+		return nodes
+	}
+
+	return attach(roots), nil
+}
+
+// UpdateCategory cambia el nombre, el slug o la categoría padre. Los valores
+// vacíos no se modifican; newParentSlug apuntando a "" convierte la categoría
+// en raíz.
+func (s *Service) UpdateCategory(ctx context.Context, slug string, newName string, newSlug string, newParentSlug *string) (models.Category, error) {
+	update := CategoryUpdate{Name: newName, Parent: newParentSlug}
+	if newSlug != "" {
+		update.Slug = models.Slugify(newSlug)
+	}
+	return s.Categories.Update(ctx, slug, update)
+}
+
+// DeleteCategory elimina una categoría sin productos ni subcategorías
+func (s *Service) DeleteCategory(ctx context.Context, slug string) error {
+	return s.Categories.Delete(ctx, slug)
+}
+
+// GormCategoryRepository guarda las categorías en Postgres
+type GormCategoryRepository struct {
+	db *gorm.DB
+}
+
+func NewGormCategoryRepository(database *gorm.DB) *GormCategoryRepository {
+	return &GormCategoryRepository{db: database}
+}
+
+func (r *GormCategoryRepository) Create(ctx context.Context, category *models.Category, parentSlug string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if _, err := findCategory(tx, category.Slug); err == nil {
+			return fmt.Errorf("category with the same slug %w", ErrAlreadyExists)
+		} else if !errors.Is(err, ErrNotFound) {
+			return err
+		}
+
+		if parentSlug != "" {
+			parent, err := findCategory(tx, parentSlug)
+			if err != nil {
+				return err
+			}
+			category.ParentID = &parent.ID
+		}
+
+		return tx.Create(category).Error
+	})
+}
+
+func (r *GormCategoryRepository) List(ctx context.Context) ([]models.Category, error) {
+	var categories []models.Category
+	err := r.db.WithContext(ctx).Order("name").Find(&categories).Error
+	return categories, err
+}
+
+func (r *GormCategoryRepository) Update(ctx context.Context, slug string, update CategoryUpdate) (models.Category, error) {
+	var category models.Category
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		if category, err = findCategory(tx, slug); err != nil {
+			return err
+		}
+
+		if update.Name != "" {
+			category.Name = update.Name
+		}
+		if update.Slug != "" && update.Slug != category.Slug {
+			if _, err := findCategory(tx, update.Slug); err == nil {
+				return fmt.Errorf("category with the same slug %w", ErrAlreadyExists)
+			} else if !errors.Is(err, ErrNotFound) {
+				return err
+			}
+			category.Slug = update.Slug
+		}
+
+		if update.Parent != nil {
+			if *update.Parent == "" {
+				category.ParentID = nil
+			} else {
+				parent, err := findCategory(tx, *update.Parent)
+				if err != nil {
+					return err
+				}
+
+				// La nueva categoría padre no puede ser ella misma ni una descendiente
+				tree, err := categoryTreeIDs(tx, category.ID)
+				if err != nil {
+					return err
+				}
+				for _, id := range tree {
+					if id == parent.ID {
+						return fmt.Errorf("%w: category cannot be moved under itself", ErrInvalid)
+					}
+				}
+				category.ParentID = &parent.ID
+			}
+		}
+
+		return tx.Model(&category).Select("name", "slug", "parent_id").Updates(&category).Error
+	})
+	if err != nil {
+		return models.Category{}, err
+	}
+
+	return category, nil
+}
+
+func (r *GormCategoryRepository) Delete(ctx context.Context, slug string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		category, err := findCategory(tx, slug)
+		if err != nil {
+			return err
+		}
+
+		// Los productos borrados siguen apuntando a la categoría hasta que se purgan
+		var count int64
+		if err := tx.Unscoped().Model(&models.Product{}).Where("category_id = ?", category.ID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return fmt.Errorf("%w: category has %d products, including deleted ones", ErrInvalid, count)
+		}
+
+		if err := tx.Model(&models.Category{}).Where("parent_id = ?", category.ID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return fmt.Errorf("%w: category has %d subcategories", ErrInvalid, count)
+		}
+
+		return tx.Delete(&category).Error
+	})
+}
@@ -0,0 +1,60 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Errores base de los controladores. Los errores devueltos los envuelven con
+// fmt.Errorf("%w") para que la capa de transporte pueda elegir el código.
+var (
+	ErrNotFound          = errors.New("not found")
+	ErrAlreadyExists     = errors.New("already exists")
+	ErrInvalid           = errors.New("invalid")
+	ErrInsufficientStock = errors.New("insufficient stock")
+	ErrConflict          = errors.New("conflict")
+)
+
+// ValidationError indica qué campos de una petición no son válidos y por qué.
+// Envuelve ErrInvalid.
+type ValidationError struct {
+	Fields map[string]string `json:"fields"`
+}
+
+func (e *ValidationError) Error() string {
+	names := make([]string, 0, len(e.Fields))
+	for name := range e.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	problems := make([]string, len(names))
+	for i, name := range names {
+		problems[i] = name + " " + e.Fields[name]
+	}
+	return fmt.Sprintf("%v: %s", ErrInvalid, strings.Join(problems, "; "))
+}
+
+func (e *ValidationError) Unwrap() error {
+	return ErrInvalid
+}
+
+// add registra el problema de un campo; se queda con el primero de cada campo
+func (e *ValidationError) add(field string, problem string) {
+	if e.Fields == nil {
+		e.Fields = make(map[string]string)
+	}
+	if _, exists := e.Fields[field]; !exists {
+		e.Fields[field] = problem
+	}
+}
+
+// orNil devuelve nil si no se registró ningún problema
+func (e *ValidationError) orNil() error {
+	if len(e.Fields) == 0 {
+		return nil
+	}
+	return e
+}
@@ -0,0 +1,263 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/FelipeGeraldoblufus/product-microservice-go/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// NewGormRepositories crea los repositorios de Postgres sobre database
+func NewGormRepositories(database *gorm.DB) Repositories {
+	return Repositories{
+		Products:     NewGormProductRepository(database),
+		Categories:   NewGormCategoryRepository(database),
+		Inventory:    NewGormInventoryRepository(database),
+		Reservations: NewGormReservationRepository(database),
+		Users:        NewGormUserRepository(database),
+	}
+}
+
+// GormProductRepository guarda los productos en Postgres
+type GormProductRepository struct {
+	db *gorm.DB
+}
+
+func NewGormProductRepository(database *gorm.DB) *GormProductRepository {
+	return &GormProductRepository{db: database}
+}
+
+// findProduct busca el producto indicado por ref con su categoría
+func findProduct(tx *gorm.DB, ref ProductRef) (models.Product, error) {
+	var product models.Product
+	if err := ref.where(tx.Preload("Category")).First(&product).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return models.Product{}, fmt.Errorf("product %w", ErrNotFound)
+		}
+		return models.Product{}, err
+	}
+	return product, nil
+}
+
+// nameTaken indica si algún producto, incluso borrado, usa el nombre
+func nameTaken(tx *gorm.DB, name string) (bool, error) {
+	var existing models.Product
+	err := tx.Unscoped().Where("name = ?", name).First(&existing).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (r *GormProductRepository) Find(ctx context.Context, ref ProductRef) (models.Product, error) {
+	return findProduct(r.db.WithContext(ctx), ref)
+}
+
+func (r *GormProductRepository) List(ctx context.Context, query ProductQuery) (ProductPage, error) {
+	query = query.withDefaults()
+	column, desc, err := query.sortOrder()
+	if err != nil {
+		return ProductPage{}, err
+	}
+
+	page := ProductPage{PageSize: query.PageSize}
+
+	// Total de productos que cumplen los filtros, sin paginar
+	if err := applyProductFilters(r.db.WithContext(ctx).Model(&models.Product{}), query).Count(&page.Total).Error; err != nil {
+		return ProductPage{}, err
+	}
+
+	direction := "ASC"
+	if desc {
+		direction = "DESC"
+	}
+	order := fmt.Sprintf("%s %s", column, direction)
+	if column != "id" {
+		order += ", id " + direction // Desempate estable para el cursor
+	}
+	tx := applyProductFilters(r.db.WithContext(ctx).Model(&models.Product{}), query).
+		Preload("Category").
+		Order(order).
+		Limit(query.PageSize + 1) // Uno más para saber si hay otra página
+
+	if query.Cursor != "" {
+		if tx, err = applyCursor(tx, query.Cursor, column, desc); err != nil {
+			return ProductPage{}, err
+		}
+	} else {
+		page.Page = query.Page
+		tx = tx.Offset((query.Page - 1) * query.PageSize)
+	}
+
+	// Consulta para obtener los productos de la página
+	var products []models.Product
+	if err := tx.Find(&products).Error; err != nil {
+		return ProductPage{}, err
+	}
+
+	if len(products) > query.PageSize {
+		products = products[:query.PageSize]
+		page.NextCursor = encodeCursor(products[len(products)-1], column)
+	}
+	page.Items = products
+
+	return page, nil
+}
+
+func (r *GormProductRepository) FindCategory(ctx context.Context, ref string) (models.Category, error) {
+	return resolveCategory(r.db.WithContext(ctx), ref)
+}
+
+func (r *GormProductRepository) Create(ctx context.Context, product *models.Product) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if taken, err := nameTaken(tx, product.Name); err != nil {
+			return err
+		} else if taken {
+			return fmt.Errorf("product with the same name %w", ErrAlreadyExists)
+		}
+
+		if err := tx.Omit(clause.Associations).Create(product).Error; err != nil {
+			return err
+		}
+
+		// Registrar el stock inicial en el historial
+		if product.Stock > 0 {
+			return recordMovement(tx, *product, product.Stock, models.MovementCreate, "", "")
+		}
+		return nil
+	})
+}
+
+func (r *GormProductRepository) Update(ctx context.Context, ref ProductRef, mutate func(product *models.Product) error) (models.Product, error) {
+	var product models.Product
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		if product, err = findProduct(tx, ref); err != nil {
+			return err
+		}
+
+		previous := product
+		if err := mutate(&product); err != nil {
+			return err
+		}
+
+		// Verifica si el nombre cambió y si existe otro producto con el mismo nombre
+		if product.Name != previous.Name {
+			if taken, err := nameTaken(tx, product.Name); err != nil {
+				return err
+			} else if taken {
+				return fmt.Errorf("product with the same name %w", ErrAlreadyExists)
+			}
+		}
+
+		// Guarda los cambios solo si nadie modificó el producto desde que se
+		// leyó, sin tocar la categoría asociada
+		product.Version = previous.Version + 1
+		result := tx.Model(&product).
+			Where("version = ?", previous.Version).
+			Select("name", "price_minor", "currency", "stock", "description", "category_id", "version").
+			Updates(&product)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("%w: product was modified concurrently", ErrConflict)
+		}
+
+		// Registra el cambio de stock en el historial
+		if product.Stock != previous.Stock {
+			return recordMovement(tx, product, product.Stock-previous.Stock, models.MovementEdit, "", "")
+		}
+		return nil
+	})
+	if err != nil {
+		return models.Product{}, err
+	}
+
+	return product, nil
+}
+
+// Delete hace un borrado lógico: se puede restaurar hasta que lo purgue
+// PurgeDeletedProducts
+func (r *GormProductRepository) Delete(ctx context.Context, ref ProductRef) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		product, err := findProduct(tx, ref)
+		if err != nil {
+			return err
+		}
+		return tx.Delete(&product).Error
+	})
+}
+
+// GormUserRepository guarda los usuarios en Postgres
+type GormUserRepository struct {
+	db *gorm.DB
+}
+
+func NewGormUserRepository(database *gorm.DB) *GormUserRepository {
+	return &GormUserRepository{db: database}
+}
+
+func (r *GormUserRepository) Create(ctx context.Context, user *models.User) error {
+	// Verificar si el nombre de usuario ya existe en la base de datos
+	if _, err := r.FindByUsername(ctx, user.Username); err == nil {
+		return fmt.Errorf("username %w", ErrAlreadyExists)
+	} else if !errors.Is(err, ErrNotFound) {
+		return err
+	}
+
+	return r.db.WithContext(ctx).Create(user).Error
+}
+
+func (r *GormUserRepository) List(ctx context.Context) ([]models.User, error) {
+	var users []models.User
+	err := r.db.WithContext(ctx).Find(&users).Error
+	return users, err
+}
+
+func (r *GormUserRepository) FindByUsername(ctx context.Context, username string) (models.User, error) {
+	var user models.User
+	if err := r.db.WithContext(ctx).Where("username = ?", username).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return models.User{}, fmt.Errorf("user %w", ErrNotFound)
+		}
+		return models.User{}, err
+	}
+	return user, nil
+}
+
+func (r *GormUserRepository) Update(ctx context.Context, user *models.User) error {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&models.User{}).
+		Where("username = ? AND id <> ?", user.Username, user.ID).
+		Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return fmt.Errorf("username %w", ErrAlreadyExists)
+	}
+
+	result := r.db.WithContext(ctx).Model(user).Select("username", "roles").Updates(user)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("user %w", ErrNotFound)
+	}
+	return nil
+}
+
+func (r *GormUserRepository) Delete(ctx context.Context, username string) error {
+	result := r.db.WithContext(ctx).Where("username = ?", username).Delete(&models.User{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("user %w", ErrNotFound)
+	}
+	return nil
+}
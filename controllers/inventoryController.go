@@ -0,0 +1,205 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/FelipeGeraldoblufus/product-microservice-go/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// StockAdjustment es un cambio relativo en el stock de un producto
+type StockAdjustment struct {
+	ProductID string `json:"product_id"`
+	Delta     int    `json:"delta"`
+	Reason    string `json:"reason"`
+}
+
+// StockHistory son los parámetros de GetStockHistory
+type StockHistory struct {
+	ProductID string `json:"product_id"`
+	Limit     int    `json:"limit"`
+	Offset    int    `json:"offset"`
+}
+
+// recordMovement guarda en el historial un cambio de stock ya aplicado a product
+func recordMovement(tx *gorm.DB, product models.Product, delta int, source string, reason string, reference string) error {
+	movement := models.InventoryMovement{
+		ProductID:  product.ID,
+		Delta:      delta,
+		StockAfter: product.Stock,
+		Source:     source,
+		Reason:     reason,
+		Reference:  reference,
+	}
+	return tx.Omit(clause.Associations).Create(&movement).Error
+}
+
+// adjustStock suma delta al stock del producto con un UPDATE condicional, de
+// modo que dos cambios concurrentes no pueden dejarlo negativo, y registra el
+// movimiento. product.Stock y product.Version quedan con los valores resultantes.
+func adjustStock(tx *gorm.DB, product *models.Product, delta int, source string, reason string, reference string) error {
+	// Unscoped porque una reserva de un producto ya borrado igual debe devolver su stock
+	result := tx.Unscoped().Model(product).
+		Clauses(clause.Returning{Columns: []clause.Column{{Name: "stock"}, {Name: "version"}}}).
+		Where("stock + ? >= 0", delta).
+		Updates(map[string]interface{}{
+			"stock":   gorm.Expr("stock + ?", delta),
+			"version": gorm.Expr("version + 1"),
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("%w for product %q", ErrInsufficientStock, product.ProductID)
+	}
+
+	return recordMovement(tx, *product, delta, source, reason, reference)
+}
+
+// lockBatch serializa dentro de la transacción los ajustes de un mismo lote,
+// para que dos ADJUST_STOCK_BULK repetidos no lo apliquen dos veces
+func lockBatch(tx *gorm.DB, batchID string) error {
+	return tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", "adjustment:"+batchID).Error
+}
+
+// batchApplied indica si ya se registraron movimientos del lote
+func batchApplied(tx *gorm.DB, batchID string) (bool, error) {
+	var applied bool
+	err := tx.Raw("SELECT EXISTS (SELECT 1 FROM inventory_movements WHERE source = ? AND reference = ?)",
+		models.MovementAdjust, batchID).Scan(&applied).Error
+	return applied, err
+}
+
+// AdjustStockBulk aplica todos los ajustes juntos: si alguno deja un stock
+// negativo no se aplica ninguno. Devuelve los productos modificados. batchID
+// es opcional e identifica el lote: repetir la llamada con el mismo batchID no
+// vuelve a aplicar los ajustes y devuelve el estado actual de los productos.
+func (s *Service) AdjustStockBulk(ctx context.Context, batchID string, adjustments []StockAdjustment) ([]models.Product, error) {
+	if len(adjustments) == 0 {
+		return nil, fmt.Errorf("%w: adjustments cannot be empty", ErrInvalid)
+	}
+
+	for _, adjustment := range adjustments {
+		if adjustment.ProductID == "" {
+			return nil, fmt.Errorf("%w: product id cannot be empty", ErrInvalid)
+		}
+		if adjustment.Delta == 0 {
+			return nil, fmt.Errorf("%w: delta cannot be zero", ErrInvalid)
+		}
+		if adjustment.Reason == "" {
+			return nil, fmt.Errorf("%w: reason cannot be empty", ErrInvalid)
+		}
+	}
+
+	return s.Inventory.Adjust(ctx, batchID, adjustments)
+}
+
+// GormInventoryRepository aplica los ajustes de stock en Postgres
+type GormInventoryRepository struct {
+	db *gorm.DB
+}
+
+func NewGormInventoryRepository(database *gorm.DB) *GormInventoryRepository {
+	return &GormInventoryRepository{db: database}
+}
+
+// Adjust aplica los ajustes en una transacción
+func (r *GormInventoryRepository) Adjust(ctx context.Context, batchID string, adjustments []StockAdjustment) ([]models.Product, error) {
+	productIDs := make([]string, len(adjustments))
+	for i, adjustment := range adjustments {
+		productIDs[i] = adjustment.ProductID
+	}
+
+	var products []models.Product
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if batchID != "" {
+			if err := lockBatch(tx, batchID); err != nil {
+				return err
+			}
+			applied, err := batchApplied(tx, batchID)
+			if err != nil {
+				return err
+			}
+			if applied {
+				return tx.Preload("Category").Where("product_id IN ?", productIDs).Order("id").Find(&products).Error
+			}
+		}
+
+		// Se bloquean las filas en orden de ID para evitar interbloqueos con otros ajustes
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("product_id IN ?", productIDs).
+			Order("id").
+			Find(&products).Error; err != nil {
+			return err
+		}
+
+		byProductID := make(map[string]*models.Product, len(products))
+		for i := range products {
+			byProductID[products[i].ProductID] = &products[i]
+		}
+
+		ordered := make([]StockAdjustment, len(adjustments))
+		copy(ordered, adjustments)
+		for _, adjustment := range ordered {
+			if byProductID[adjustment.ProductID] == nil {
+				return fmt.Errorf("product %q %w", adjustment.ProductID, ErrNotFound)
+			}
+		}
+		sort.SliceStable(ordered, func(i, j int) bool {
+			return byProductID[ordered[i].ProductID].ID < byProductID[ordered[j].ProductID].ID
+		})
+
+		for _, adjustment := range ordered {
+			product := byProductID[adjustment.ProductID]
+			if err := adjustStock(tx, product, adjustment.Delta, models.MovementAdjust, adjustment.Reason, batchID); err != nil {
+				return err
+			}
+		}
+
+		// Las filas bloqueadas se leyeron sin categoría. Se cargan aquí para que
+		// nada pueda fallar después de confirmar los ajustes.
+		ids := make([]uint, len(products))
+		for i, product := range products {
+			ids[i] = product.ID
+		}
+		products = nil
+		return tx.Preload("Category").Where("id IN ?", ids).Order("id").Find(&products).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return products, nil
+}
+
+// GetStockHistory devuelve los movimientos de stock de un producto, del más reciente al más antiguo
+func (s *Service) GetStockHistory(ctx context.Context, query StockHistory) ([]models.InventoryMovement, error) {
+	if query.Limit <= 0 {
+		query.Limit = defaultPageSize
+	}
+	if query.Limit > maxPageSize {
+		query.Limit = maxPageSize
+	}
+	if query.Offset < 0 {
+		query.Offset = 0
+	}
+
+	return s.Products.StockHistory(ctx, query)
+}
+
+func (r *GormProductRepository) StockHistory(ctx context.Context, query StockHistory) ([]models.InventoryMovement, error) {
+	product, err := r.Find(ctx, ProductRef{ProductID: query.ProductID})
+	if err != nil {
+		return nil, err
+	}
+
+	movements := []models.InventoryMovement{}
+	err = r.db.WithContext(ctx).Where("product_id = ?", product.ID).
+		Order("created_at DESC, id DESC").
+		Limit(query.Limit).
+		Offset(query.Offset).
+		Find(&movements).Error
+	return movements, err
+}
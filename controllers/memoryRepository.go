@@ -0,0 +1,664 @@
+package controllers
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/FelipeGeraldoblufus/product-microservice-go/models"
+	"gorm.io/gorm"
+)
+
+// memoryStore guarda los datos que comparten los repositorios en memoria. Cada
+// operación se hace con el mutex tomado, como si fuera una transacción.
+type memoryStore struct {
+	mu           sync.Mutex
+	products     []models.Product  // Ordenados por ID, incluidos los borrados
+	categories   []models.Category // Ordenadas por ID
+	movements    []models.InventoryMovement
+	reservations []models.StockReservation
+}
+
+// NewMemoryRepositories crea repositorios en memoria que comparten los datos,
+// con las categorías dadas y sin usuarios. Las categorías sin ID reciben uno
+// consecutivo. Permiten usar Service sin Postgres, por ejemplo para probar en
+// el mismo proceso toda la capa RPC. A diferencia de Postgres, el orden por
+// nombre compara bytes y la búsqueda no reduce las palabras a su raíz.
+func NewMemoryRepositories(categories ...models.Category) Repositories {
+	store := &memoryStore{}
+	for _, category := range categories {
+		if category.ID == 0 {
+			category.ID = store.nextCategoryID()
+		}
+		store.categories = append(store.categories, category)
+	}
+	slices.SortFunc(store.categories, func(a, b models.Category) int { return cmp.Compare(a.ID, b.ID) })
+
+	return Repositories{
+		Products:     &MemoryProductRepository{store},
+		Categories:   &MemoryCategoryRepository{store},
+		Inventory:    &MemoryInventoryRepository{store},
+		Reservations: &MemoryReservationRepository{store},
+		Users:        NewMemoryUserRepository(),
+	}
+}
+
+// index devuelve la posición del producto indicado por ref, o -1. Los
+// borrados solo se consideran con withDeleted.
+func (s *memoryStore) index(ref ProductRef, withDeleted bool) int {
+	id, numeric := uint64(0), false
+	if parsed, err := strconv.ParseUint(ref.ProductID, 10, 64); err == nil {
+		id, numeric = parsed, true
+	}
+
+	for i, product := range s.products {
+		if product.DeletedAt.Valid && !withDeleted {
+			continue
+		}
+		switch {
+		case ref.ProductID != "":
+			if product.ProductID == ref.ProductID || (numeric && uint64(product.ID) == id) {
+				return i
+			}
+		case product.Name == ref.Name:
+			return i
+		}
+	}
+	return -1
+}
+
+// byProductID devuelve la posición del producto no borrado con ese product_id, o -1
+func (s *memoryStore) byProductID(productID string) int {
+	return slices.IndexFunc(s.products, func(product models.Product) bool {
+		return product.ProductID == productID && !product.DeletedAt.Valid
+	})
+}
+
+// byID devuelve la posición del producto con ese ID, aunque esté borrado, o -1
+func (s *memoryStore) byID(id uint) int {
+	return slices.IndexFunc(s.products, func(product models.Product) bool { return product.ID == id })
+}
+
+func (s *memoryStore) nameTaken(name string, exceptID uint) bool {
+	for _, product := range s.products {
+		if product.Name == name && product.ID != exceptID {
+			return true
+		}
+	}
+	return false
+}
+
+// withCategory devuelve product con su categoría actual
+func (s *memoryStore) withCategory(product models.Product) models.Product {
+	if i := slices.IndexFunc(s.categories, func(c models.Category) bool { return c.ID == product.CategoryID }); i >= 0 {
+		product.Category = s.categories[i]
+	}
+	return product
+}
+
+func (s *memoryStore) recordMovement(product models.Product, delta int, source string, reason string, reference string) {
+	s.movements = append(s.movements, models.InventoryMovement{
+		ID:         uint(len(s.movements) + 1),
+		ProductID:  product.ID,
+		Delta:      delta,
+		StockAfter: product.Stock,
+		Source:     source,
+		Reason:     reason,
+		Reference:  reference,
+		CreatedAt:  time.Now(),
+	})
+}
+
+// adjustStock suma delta al stock del producto en la posición i y registra el
+// movimiento. Quien llama comprueba antes que el stock no quede negativo.
+func (s *memoryStore) adjustStock(i int, delta int, source string, reason string, reference string) {
+	s.products[i].Stock += delta
+	s.products[i].Version++
+	s.recordMovement(s.products[i], delta, source, reason, reference)
+}
+
+// categoryIndex devuelve la posición de la categoría con ese slug, o -1
+func (s *memoryStore) categoryIndex(slug string) int {
+	return slices.IndexFunc(s.categories, func(category models.Category) bool { return category.Slug == slug })
+}
+
+func (s *memoryStore) nextCategoryID() uint {
+	id := uint(1)
+	for _, category := range s.categories {
+		id = max(id, category.ID+1)
+	}
+	return id
+}
+
+// categoryTree devuelve el ID de la categoría y los de todas sus descendientes
+func (s *memoryStore) categoryTree(id uint) map[uint]bool {
+	tree := map[uint]bool{id: true}
+	// Se recorre hasta que no aparezcan más descendientes
+	for grew := true; grew; {
+		grew = false
+		for _, category := range s.categories {
+			if category.ParentID != nil && tree[*category.ParentID] && !tree[category.ID] {
+				tree[category.ID] = true
+				grew = true
+			}
+		}
+	}
+	return tree
+}
+
+// MemoryProductRepository guarda los productos en memoria
+type MemoryProductRepository struct {
+	*memoryStore
+}
+
+func (r *MemoryProductRepository) Find(ctx context.Context, ref ProductRef) (models.Product, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.index(ref, false)
+	if i < 0 {
+		return models.Product{}, fmt.Errorf("product %w", ErrNotFound)
+	}
+	return r.withCategory(r.products[i]), nil
+}
+
+func (r *MemoryProductRepository) List(ctx context.Context, query ProductQuery) (ProductPage, error) {
+	query = query.withDefaults()
+	column, desc, err := query.sortOrder()
+	if err != nil {
+		return ProductPage{}, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var tree map[uint]bool
+	if query.Category != "" {
+		tree = map[uint]bool{}
+		if i := r.categoryIndex(query.Category); i >= 0 {
+			tree = r.categoryTree(r.categories[i].ID)
+		}
+	}
+	products := []models.Product{}
+	for _, product := range r.products {
+		switch {
+		case product.DeletedAt.Valid,
+			tree != nil && !tree[product.CategoryID],
+			query.MinPrice != nil && product.Price < *query.MinPrice,
+			query.MaxPrice != nil && product.Price > *query.MaxPrice,
+			query.InStock != nil && *query.InStock != (product.Stock > 0):
+			continue
+		}
+		products = append(products, r.withCategory(product))
+	}
+
+	page := ProductPage{PageSize: query.PageSize, Total: int64(len(products))}
+
+	order := func(a, b models.Product) int {
+		if desc {
+			return compareProducts(b, a, column)
+		}
+		return compareProducts(a, b, column)
+	}
+	slices.SortFunc(products, order)
+
+	if query.Cursor != "" {
+		after, err := decodeCursor(query.Cursor, column)
+		if err != nil {
+			return ProductPage{}, err
+		}
+		start := len(products)
+		for i, product := range products {
+			if order(product, after) > 0 {
+				start = i
+				break
+			}
+		}
+		products = products[start:]
+	} else {
+		page.Page = query.Page
+		offset := min((query.Page-1)*query.PageSize, len(products))
+		products = products[offset:]
+	}
+
+	if len(products) > query.PageSize {
+		products = products[:query.PageSize]
+		page.NextCursor = encodeCursor(products[len(products)-1], column)
+	}
+	page.Items = products
+
+	return page, nil
+}
+
+// Search compara palabras completas o, con Prefix, prefijos. La relevancia
+// suma por cada término los pesos que usa ts_rank para el nombre, la
+// categoría y la descripción.
+func (r *MemoryProductRepository) Search(ctx context.Context, search ProductSearch) ([]ProductSearchResult, error) {
+	terms := searchTermPattern.FindAllString(strings.ToLower(search.Query), -1)
+	match := func(word string, term string) bool {
+		return word == term || (*search.Prefix && strings.HasPrefix(word, term))
+	}
+	// found devuelve cuántos términos aparecen en alguno de los textos
+	found := func(texts ...string) int {
+		var words []string
+		for _, text := range texts {
+			words = append(words, searchTermPattern.FindAllString(strings.ToLower(text), -1)...)
+		}
+		count := 0
+		for _, term := range terms {
+			if slices.ContainsFunc(words, func(word string) bool { return match(word, term) }) {
+				count++
+			}
+		}
+		return count
+	}
+	highlight := func(text string) string {
+		return searchTermPattern.ReplaceAllStringFunc(text, func(word string) string {
+			if slices.ContainsFunc(terms, func(term string) bool { return match(strings.ToLower(word), term) }) {
+				return "<mark>" + word + "</mark>"
+			}
+			return word
+		})
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	results := []ProductSearchResult{}
+	for _, product := range r.products {
+		if product.DeletedAt.Valid {
+			continue
+		}
+		product = r.withCategory(product)
+		// Igual que en Postgres, todos los términos deben aparecer en el
+		// producto o todos en su categoría
+		if found(product.Name, product.Description) < len(terms) && found(product.Category.Name) < len(terms) {
+			continue
+		}
+		results = append(results, ProductSearchResult{
+			Product:              product,
+			Rank:                 1.0*float64(found(product.Name)) + 0.4*float64(found(product.Category.Name)) + 0.2*float64(found(product.Description)),
+			NameHighlight:        highlight(product.Name),
+			DescriptionHighlight: highlight(product.Description),
+		})
+	}
+
+	slices.SortStableFunc(results, func(a, b ProductSearchResult) int {
+		if c := cmp.Compare(b.Rank, a.Rank); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Product.ID, b.Product.ID)
+	})
+	results = results[min(search.Offset, len(results)):]
+	return results[:min(search.Limit, len(results))], nil
+}
+
+func (r *MemoryProductRepository) FindCategory(ctx context.Context, ref string) (models.Category, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Primero por slug y, si no existe, por nombre, igual que en Postgres
+	if i := r.categoryIndex(ref); i >= 0 {
+		return r.categories[i], nil
+	}
+	for _, category := range r.categories {
+		if category.Name == ref {
+			return category, nil
+		}
+	}
+	return models.Category{}, fmt.Errorf("%w: category %q does not exist", ErrInvalid, ref)
+}
+
+func (r *MemoryProductRepository) Create(ctx context.Context, product *models.Product) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.nameTaken(product.Name, 0) {
+		return fmt.Errorf("product with the same name %w", ErrAlreadyExists)
+	}
+
+	product.ID = 1
+	if len(r.products) > 0 {
+		product.ID = r.products[len(r.products)-1].ID + 1
+	}
+	if product.CreatedAt.IsZero() {
+		product.CreatedAt = time.Now()
+	}
+	if product.Version == 0 {
+		product.Version = 1
+	}
+	r.products = append(r.products, *product)
+
+	if product.Stock > 0 {
+		r.recordMovement(*product, product.Stock, models.MovementCreate, "", "")
+	}
+	return nil
+}
+
+func (r *MemoryProductRepository) Update(ctx context.Context, ref ProductRef, mutate func(product *models.Product) error) (models.Product, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.index(ref, false)
+	if i < 0 {
+		return models.Product{}, fmt.Errorf("product %w", ErrNotFound)
+	}
+
+	previous := r.withCategory(r.products[i])
+	product := previous
+	if err := mutate(&product); err != nil {
+		return models.Product{}, err
+	}
+	if product.Name != previous.Name && r.nameTaken(product.Name, product.ID) {
+		return models.Product{}, fmt.Errorf("product with the same name %w", ErrAlreadyExists)
+	}
+
+	product.Version = previous.Version + 1
+	r.products[i] = product
+
+	if product.Stock != previous.Stock {
+		r.recordMovement(product, product.Stock-previous.Stock, models.MovementEdit, "", "")
+	}
+	return product, nil
+}
+
+func (r *MemoryProductRepository) Delete(ctx context.Context, ref ProductRef) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.index(ref, false)
+	if i < 0 {
+		return fmt.Errorf("product %w", ErrNotFound)
+	}
+	r.products[i].DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+	return nil
+}
+
+func (r *MemoryProductRepository) ListDeleted(ctx context.Context, query DeletedProductQuery) (ProductPage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	products := []models.Product{}
+	for _, product := range r.products {
+		if product.DeletedAt.Valid {
+			products = append(products, r.withCategory(product))
+		}
+	}
+	slices.SortFunc(products, func(a, b models.Product) int {
+		if c := b.DeletedAt.Time.Compare(a.DeletedAt.Time); c != 0 {
+			return c
+		}
+		return cmp.Compare(b.ID, a.ID)
+	})
+
+	page := ProductPage{Page: query.Page, PageSize: query.PageSize, Total: int64(len(products))}
+	products = products[min((query.Page-1)*query.PageSize, len(products)):]
+	page.Items = products[:min(query.PageSize, len(products))]
+	return page, nil
+}
+
+func (r *MemoryProductRepository) Restore(ctx context.Context, productID string) (models.Product, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.index(ProductRef{ProductID: productID}, true)
+	if i < 0 {
+		return models.Product{}, fmt.Errorf("product %w", ErrNotFound)
+	}
+	if !r.products[i].DeletedAt.Valid {
+		return models.Product{}, fmt.Errorf("%w: product is not deleted", ErrInvalid)
+	}
+
+	r.products[i].DeletedAt = gorm.DeletedAt{}
+	r.products[i].Version++
+	return r.withCategory(r.products[i]), nil
+}
+
+func (r *MemoryProductRepository) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	purged := make(map[uint]bool)
+	r.products = slices.DeleteFunc(r.products, func(product models.Product) bool {
+		if product.DeletedAt.Valid && product.DeletedAt.Time.Before(before) {
+			purged[product.ID] = true
+		}
+		return purged[product.ID]
+	})
+	r.movements = slices.DeleteFunc(r.movements, func(movement models.InventoryMovement) bool {
+		return purged[movement.ProductID]
+	})
+	r.reservations = slices.DeleteFunc(r.reservations, func(reservation models.StockReservation) bool {
+		return purged[reservation.ProductID]
+	})
+	return int64(len(purged)), nil
+}
+
+func (r *MemoryProductRepository) StockHistory(ctx context.Context, query StockHistory) ([]models.InventoryMovement, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.index(ProductRef{ProductID: query.ProductID}, false)
+	if i < 0 {
+		return nil, fmt.Errorf("product %w", ErrNotFound)
+	}
+
+	movements := []models.InventoryMovement{}
+	for _, movement := range r.movements {
+		if movement.ProductID == r.products[i].ID {
+			movements = append(movements, movement)
+		}
+	}
+	slices.SortFunc(movements, func(a, b models.InventoryMovement) int {
+		if c := b.CreatedAt.Compare(a.CreatedAt); c != 0 {
+			return c
+		}
+		return cmp.Compare(b.ID, a.ID)
+	})
+
+	movements = movements[min(query.Offset, len(movements)):]
+	return movements[:min(query.Limit, len(movements))], nil
+}
+
+// MemoryCategoryRepository guarda las categorías en memoria
+type MemoryCategoryRepository struct {
+	*memoryStore
+}
+
+func (r *MemoryCategoryRepository) Create(ctx context.Context, category *models.Category, parentSlug string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.categoryIndex(category.Slug) >= 0 {
+		return fmt.Errorf("category with the same slug %w", ErrAlreadyExists)
+	}
+	if parentSlug != "" {
+		i := r.categoryIndex(parentSlug)
+		if i < 0 {
+			return fmt.Errorf("category %q %w", parentSlug, ErrNotFound)
+		}
+		parentID := r.categories[i].ID
+		category.ParentID = &parentID
+	}
+
+	category.ID = r.nextCategoryID()
+	r.categories = append(r.categories, *category)
+	return nil
+}
+
+func (r *MemoryCategoryRepository) List(ctx context.Context) ([]models.Category, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	categories := slices.Clone(r.categories)
+	slices.SortStableFunc(categories, func(a, b models.Category) int { return strings.Compare(a.Name, b.Name) })
+	return categories, nil
+}
+
+func (r *MemoryCategoryRepository) Update(ctx context.Context, slug string, update CategoryUpdate) (models.Category, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.categoryIndex(slug)
+	if i < 0 {
+		return models.Category{}, fmt.Errorf("category %q %w", slug, ErrNotFound)
+	}
+	category := r.categories[i]
+
+	if update.Name != "" {
+		category.Name = update.Name
+	}
+	if update.Slug != "" && update.Slug != category.Slug {
+		if r.categoryIndex(update.Slug) >= 0 {
+			return models.Category{}, fmt.Errorf("category with the same slug %w", ErrAlreadyExists)
+		}
+		category.Slug = update.Slug
+	}
+
+	if update.Parent != nil {
+		if *update.Parent == "" {
+			category.ParentID = nil
+		} else {
+			parent := r.categoryIndex(*update.Parent)
+			if parent < 0 {
+				return models.Category{}, fmt.Errorf("category %q %w", *update.Parent, ErrNotFound)
+			}
+			// La nueva categoría padre no puede ser ella misma ni una descendiente
+			parentID := r.categories[parent].ID
+			if r.categoryTree(category.ID)[parentID] {
+				return models.Category{}, fmt.Errorf("%w: category cannot be moved under itself", ErrInvalid)
+			}
+			category.ParentID = &parentID
+		}
+	}
+
+	r.categories[i] = category
+	return category, nil
+}
+
+func (r *MemoryCategoryRepository) Delete(ctx context.Context, slug string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.categoryIndex(slug)
+	if i < 0 {
+		return fmt.Errorf("category %q %w", slug, ErrNotFound)
+	}
+	id := r.categories[i].ID
+
+	// Los productos borrados siguen apuntando a la categoría hasta que se purgan
+	products := 0
+	for _, product := range r.products {
+		if product.CategoryID == id {
+			products++
+		}
+	}
+	if products > 0 {
+		return fmt.Errorf("%w: category has %d products, including deleted ones", ErrInvalid, products)
+	}
+
+	children := 0
+	for _, category := range r.categories {
+		if category.ParentID != nil && *category.ParentID == id {
+			children++
+		}
+	}
+	if children > 0 {
+		return fmt.Errorf("%w: category has %d subcategories", ErrInvalid, children)
+	}
+
+	r.categories = slices.Delete(r.categories, i, i+1)
+	return nil
+}
+
+// MemoryUserRepository guarda los usuarios en memoria
+type MemoryUserRepository struct {
+	mu     sync.Mutex
+	users  []models.User
+	nextID uint
+}
+
+func NewMemoryUserRepository(users ...models.User) *MemoryUserRepository {
+	r := &MemoryUserRepository{}
+	for _, user := range users {
+		r.add(&user)
+	}
+	return r
+}
+
+func (r *MemoryUserRepository) add(user *models.User) {
+	r.nextID++
+	user.ID = r.nextID
+	r.users = append(r.users, *user)
+}
+
+func (r *MemoryUserRepository) index(username string) int {
+	for i, user := range r.users {
+		if user.Username == username {
+			return i
+		}
+	}
+	return -1
+}
+
+func (r *MemoryUserRepository) Create(ctx context.Context, user *models.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.index(user.Username) >= 0 {
+		return fmt.Errorf("username %w", ErrAlreadyExists)
+	}
+	r.add(user)
+	return nil
+}
+
+func (r *MemoryUserRepository) List(ctx context.Context) ([]models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return slices.Clone(r.users), nil
+}
+
+func (r *MemoryUserRepository) FindByUsername(ctx context.Context, username string) (models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.index(username)
+	if i < 0 {
+		return models.User{}, fmt.Errorf("user %w", ErrNotFound)
+	}
+	return r.users[i], nil
+}
+
+func (r *MemoryUserRepository) Update(ctx context.Context, user *models.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if i := r.index(user.Username); i >= 0 && r.users[i].ID != user.ID {
+		return fmt.Errorf("username %w", ErrAlreadyExists)
+	}
+	for i := range r.users {
+		if r.users[i].ID == user.ID {
+			r.users[i] = *user
+			return nil
+		}
+	}
+	return fmt.Errorf("user %w", ErrNotFound)
+}
+
+func (r *MemoryUserRepository) Delete(ctx context.Context, username string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.index(username)
+	if i < 0 {
+		return fmt.Errorf("user %w", ErrNotFound)
+	}
+	r.users = slices.Delete(r.users, i, i+1)
+	return nil
+}
@@ -0,0 +1,233 @@
+package controllers
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/FelipeGeraldoblufus/product-microservice-go/models"
+)
+
+// MemoryInventoryRepository aplica los ajustes de stock en memoria
+type MemoryInventoryRepository struct {
+	*memoryStore
+}
+
+func (r *MemoryInventoryRepository) Adjust(ctx context.Context, batchID string, adjustments []StockAdjustment) ([]models.Product, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Posición de cada producto ajustado, en orden de ID
+	var indexes []int
+	for _, adjustment := range adjustments {
+		if i := r.byProductID(adjustment.ProductID); i >= 0 && !slices.Contains(indexes, i) {
+			indexes = append(indexes, i)
+		}
+	}
+	slices.Sort(indexes)
+	products := func() []models.Product {
+		products := make([]models.Product, len(indexes))
+		for j, i := range indexes {
+			products[j] = r.withCategory(r.products[i])
+		}
+		return products
+	}
+
+	if batchID != "" && slices.ContainsFunc(r.movements, func(movement models.InventoryMovement) bool {
+		return movement.Source == models.MovementAdjust && movement.Reference == batchID
+	}) {
+		return products(), nil
+	}
+
+	for _, adjustment := range adjustments {
+		if r.byProductID(adjustment.ProductID) < 0 {
+			return nil, fmt.Errorf("product %q %w", adjustment.ProductID, ErrNotFound)
+		}
+	}
+	// Se aplican en orden de ID, igual que en Postgres
+	ordered := slices.Clone(adjustments)
+	slices.SortStableFunc(ordered, func(a, b StockAdjustment) int {
+		return cmp.Compare(r.byProductID(a.ProductID), r.byProductID(b.ProductID))
+	})
+
+	// Se comprueba todo el lote antes de cambiar nada
+	stock := make(map[int]int, len(indexes))
+	for _, adjustment := range ordered {
+		i := r.byProductID(adjustment.ProductID)
+		if _, ok := stock[i]; !ok {
+			stock[i] = r.products[i].Stock
+		}
+		stock[i] += adjustment.Delta
+		if stock[i] < 0 {
+			return nil, fmt.Errorf("%w for product %q", ErrInsufficientStock, adjustment.ProductID)
+		}
+	}
+
+	for _, adjustment := range ordered {
+		r.adjustStock(r.byProductID(adjustment.ProductID), adjustment.Delta, models.MovementAdjust, adjustment.Reason, batchID)
+	}
+	return products(), nil
+}
+
+// MemoryReservationRepository guarda las reservas en memoria
+type MemoryReservationRepository struct {
+	*memoryStore
+}
+
+// orderReservations devuelve las posiciones de las reservas del pedido, en orden de producto
+func (r *MemoryReservationRepository) orderReservations(orderID string) []int {
+	var indexes []int
+	for i, reservation := range r.reservations {
+		if reservation.OrderID == orderID {
+			indexes = append(indexes, i)
+		}
+	}
+	slices.SortFunc(indexes, func(a, b int) int {
+		return cmp.Compare(r.reservations[a].ProductID, r.reservations[b].ProductID)
+	})
+	return indexes
+}
+
+// reservation resume las reservas en esas posiciones
+func (r *MemoryReservationRepository) reservation(orderID string, indexes []int) Reservation {
+	reservations := make([]models.StockReservation, len(indexes))
+	for j, i := range indexes {
+		reservations[j] = r.reservations[i]
+	}
+	return toReservation(orderID, reservations)
+}
+
+// releaseStock devuelve al stock las cantidades reservadas y deja las reservas en status
+func (r *MemoryReservationRepository) releaseStock(indexes []int, status string) {
+	source := models.MovementRelease
+	if status == models.ReservationExpired {
+		source = models.MovementExpire
+	}
+
+	for _, i := range indexes {
+		reservation := &r.reservations[i]
+		// Una reserva de un producto ya borrado igual devuelve su stock
+		if product := r.byID(reservation.ProductID); product >= 0 {
+			r.adjustStock(product, reservation.Quantity, source, "", reservation.OrderID)
+		}
+		reservation.Status = status
+		reservation.UpdatedAt = time.Now()
+	}
+}
+
+func (r *MemoryReservationRepository) Reserve(ctx context.Context, orderID string, quantities map[string]int, expiresAt time.Time) (Reservation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if existing := r.orderReservations(orderID); len(existing) > 0 {
+		return r.reservation(orderID, existing), nil
+	}
+
+	indexes := make([]int, 0, len(quantities))
+	for productID := range quantities {
+		i := r.byProductID(productID)
+		if i < 0 {
+			return Reservation{}, fmt.Errorf("product %q %w", productID, ErrNotFound)
+		}
+		indexes = append(indexes, i)
+	}
+	slices.Sort(indexes)
+
+	for _, i := range indexes {
+		if product := r.products[i]; product.Stock < quantities[product.ProductID] {
+			return Reservation{}, fmt.Errorf("%w for product %q", ErrInsufficientStock, product.ProductID)
+		}
+	}
+
+	now := time.Now()
+	created := make([]int, len(indexes))
+	for j, i := range indexes {
+		quantity := quantities[r.products[i].ProductID]
+		r.adjustStock(i, -quantity, models.MovementReserve, "", orderID)
+
+		created[j] = len(r.reservations)
+		r.reservations = append(r.reservations, models.StockReservation{
+			ID:        uint(len(r.reservations) + 1),
+			OrderID:   orderID,
+			ProductID: r.products[i].ID,
+			Product:   r.products[i],
+			Quantity:  quantity,
+			Status:    models.ReservationReserved,
+			ExpiresAt: expiresAt,
+			CreatedAt: now,
+			UpdatedAt: now,
+		})
+	}
+	return r.reservation(orderID, created), nil
+}
+
+func (r *MemoryReservationRepository) Commit(ctx context.Context, orderID string) (Reservation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	indexes := r.orderReservations(orderID)
+	if len(indexes) == 0 {
+		return Reservation{}, fmt.Errorf("reservation for order %q %w", orderID, ErrNotFound)
+	}
+
+	first := r.reservations[indexes[0]]
+	switch first.Status {
+	case models.ReservationCommitted:
+		return r.reservation(orderID, indexes), nil
+	case models.ReservationReserved:
+	default:
+		return Reservation{}, fmt.Errorf("%w: reservation for order %q is %s", ErrInvalid, orderID, first.Status)
+	}
+
+	// Una reserva vencida que el barrido aún no procesó se expira aquí
+	if !first.ExpiresAt.After(time.Now()) {
+		r.releaseStock(indexes, models.ReservationExpired)
+		return Reservation{}, fmt.Errorf("%w: reservation for order %q is %s", ErrInvalid, orderID, models.ReservationExpired)
+	}
+
+	for _, i := range indexes {
+		r.reservations[i].Status = models.ReservationCommitted
+		r.reservations[i].UpdatedAt = time.Now()
+	}
+	return r.reservation(orderID, indexes), nil
+}
+
+func (r *MemoryReservationRepository) Release(ctx context.Context, orderID string) (Reservation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	indexes := r.orderReservations(orderID)
+	if len(indexes) == 0 {
+		return Reservation{}, fmt.Errorf("reservation for order %q %w", orderID, ErrNotFound)
+	}
+
+	switch r.reservations[indexes[0]].Status {
+	case models.ReservationReleased, models.ReservationExpired:
+		return r.reservation(orderID, indexes), nil
+	case models.ReservationCommitted:
+		return Reservation{}, fmt.Errorf("%w: reservation for order %q is already committed", ErrInvalid, orderID)
+	}
+
+	r.releaseStock(indexes, models.ReservationReleased)
+	return r.reservation(orderID, indexes), nil
+}
+
+func (r *MemoryReservationRepository) Expire(ctx context.Context, now time.Time) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var orderIDs []string
+	for _, reservation := range r.reservations {
+		if reservation.Status == models.ReservationReserved && !reservation.ExpiresAt.After(now) &&
+			!slices.Contains(orderIDs, reservation.OrderID) {
+			orderIDs = append(orderIDs, reservation.OrderID)
+		}
+	}
+
+	for _, orderID := range orderIDs {
+		r.releaseStock(r.orderReservations(orderID), models.ReservationExpired)
+	}
+	return len(orderIDs), nil
+}
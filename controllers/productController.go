@@ -1,34 +1,36 @@
 package controllers
 
 import (
+	"context"
 	"errors"
 	db "github.com/FelipeGeraldoblufus/product-microservice-go/config"
 	"github.com/FelipeGeraldoblufus/product-microservice-go/models"
 	"gorm.io/gorm"
 
 	"fmt"
-	"math/rand"
-	"time"
+	"strconv"
+	"strings"
 )
 
+// Service reúne las operaciones sobre productos, categorías, inventario,
+// reservas y usuarios. Valida las peticiones y lee y guarda los datos a través
+// de los repositorios: en producción los de Postgres y en pruebas los de memoria.
+type Service struct {
+	Repositories
+}
 
+func NewService(repositories Repositories) *Service {
+	return &Service{Repositories: repositories}
+}
 
-func CreateUser(username string) (*models.User, error) {
+func (s *Service) CreateUser(ctx context.Context, username string) (*models.User, error) {
 	// Crear un nuevo usuario sin el carrito (carrito ha sido eliminado)
 	newUser := models.User{
 		Username: username,
 	}
 
-	// Verificar si el nombre de usuario ya existe en la base de datos
-	var existingUser models.User
-	if err := db.DB.Where("username = ?", newUser.Username).First(&existingUser).Error; err == nil {
-		// Si el usuario ya existe, devolver un error
-		return nil, errors.New("username already exists")
-	}
-
-	// Guardar el nuevo usuario en la base de datos
-	if err := db.DB.Save(&newUser).Error; err != nil {
-		// Si ocurre un error al guardar, devolverlo
+	// Guardar el nuevo usuario; falla si el nombre de usuario ya existe
+	if err := s.Users.Create(ctx, &newUser); err != nil {
 		return nil, err
 	}
 
@@ -36,220 +38,212 @@ func CreateUser(username string) (*models.User, error) {
 	return &newUser, nil
 }
 
-func GetUser(usuario string) ([]models.User, error) {
-	var user []models.User
-	err := db.DB.Find(&user).Error
+func (s *Service) GetUser(ctx context.Context, usuario string) ([]models.User, error) {
+	return s.Users.List(ctx)
+}
 
+// GetByUser devuelve el usuario con ese nombre o, si no existe, un usuario vacío
+func (s *Service) GetByUser(ctx context.Context, username string) (models.User, error) {
+	user, err := s.Users.FindByUsername(ctx, username)
+	if errors.Is(err, ErrNotFound) {
+		return models.User{}, nil
+	}
 	return user, err
 }
 
-func GetByUser(username string) (models.User, error) {
-	var users models.User
-	err := db.DB.Where("username = ?", username).Find(&users).Error
-
-	return users, err
+// FindUser devuelve el usuario con ese nombre; ErrNotFound si no existe
+func (s *Service) FindUser(ctx context.Context, username string) (models.User, error) {
+	return s.Users.FindByUsername(ctx, username)
 }
 
-// Función para obtener un producto por su ID
-func GetByProductID(productID string) (models.Product, error) {
-    var product models.Product
-
-    // Buscar el producto por su product_id en la base de datos
-    if err := db.DB.Where("product_id = ?", productID).First(&product).Error; err != nil {
-        if err == gorm.ErrRecordNotFound {
-            // Si no se encuentra el producto
-            return models.Product{}, errors.New("product not found")
-        }
-        return models.Product{}, err
-    }
-
-    // Devolver el producto encontrado
-    return product, nil
+// Función para obtener un producto por su product_id o su ID numérico
+func (s *Service) GetByProductID(ctx context.Context, productID string) (models.Product, error) {
+	return s.Products.Find(ctx, ProductRef{ProductID: productID})
 }
 
-func GetAllProducts() ([]models.Product, error) {
-	var products []models.Product
+// GetAllProducts devuelve una página de productos filtrada y ordenada según query
+func (s *Service) GetAllProducts(ctx context.Context, query ProductQuery) (ProductPage, error) {
+	return s.Products.List(ctx, query)
+}
 
-	// Consulta para obtener todos los productos
-	if err := db.DB.Find(&products).Error; err != nil {
-		return nil, err
+// UpdateProduct aplica patch al producto indicado por ref: solo cambian los campos presentes.
+// Si expectedVersion no es nil y el producto cambió desde esa versión,
+// devuelve ErrConflict sin modificarlo. Los campos no válidos se devuelven
+// todos juntos en un ValidationError.
+func (s *Service) UpdateProduct(ctx context.Context, ref ProductRef, expectedVersion *int, patch ProductPatch) (models.Product, error) {
+	// Valida los campos antes de leer el producto
+	if err := patch.validate(); err != nil {
+		return models.Product{}, err
+	}
+	if err := ref.validate(); err != nil {
+		return models.Product{}, err
 	}
 
-	return products, nil
-}
-
-func UpdateProduct(productoIngresado string, newName string, newPrice int, newStock int, newDescription string, newCategory string) (models.Product, error) {
-	// Inicia una transacción
-	tx := db.DB.Begin()
-	defer func() {
-		// Recupera la transacción en caso de error y finaliza la función
-		if r := recover(); r != nil {
-			tx.Rollback()
+	var category *models.Category
+	if patch.Category != nil {
+		found, err := s.Products.FindCategory(ctx, *patch.Category)
+		if errors.Is(err, ErrInvalid) {
+			return models.Product{}, &ValidationError{Fields: map[string]string{"category": "does not exist"}}
 		}
-	}()
-
-	// Consulta la base de datos para obtener el producto existente por su nombre
-	var producto models.Product
-	if err := tx.Where("name = ?", productoIngresado).First(&producto).Error; err != nil {
-		tx.Rollback()
-		return producto, err
+		if err != nil {
+			return models.Product{}, err
+		}
+		category = &found
 	}
 
-	// Verifica si el nombre está siendo cambiado y si existe otro producto con el mismo nombre
-	if producto.Name != newName {
-		var duplicateProduct models.Product
-		if err := tx.Where("name = ?", newName).First(&duplicateProduct).Error; err == nil {
-			// Ya existe un producto con el nuevo nombre
-			tx.Rollback()
-			return producto, errors.New("product with the same name already exists")
-		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
-			// Otro error al buscar el producto duplicado
-			tx.Rollback()
-			return producto, err
+	return s.Products.Update(ctx, ref, func(producto *models.Product) error {
+		if expectedVersion != nil && *expectedVersion != producto.Version {
+			return fmt.Errorf("%w: product is at version %d, expected %d", ErrConflict, producto.Version, *expectedVersion)
 		}
-	}
 
-	// Actualiza los campos del producto existente con los nuevos valores
-	if newName != "" {
-		producto.Name = newName
-	}
-	if newPrice > 0 {
-		producto.Price = newPrice
-	}
-	if newStock >= 0 {
-		producto.Stock = newStock
-	}
-	if newDescription != "" {
-		producto.Description = newDescription
+		// Actualiza los campos presentes en el patch
+		if patch.Name != nil {
+			producto.Name = *patch.Name
+		}
+		if patch.Price != nil {
+			producto.Price = *patch.Price
+		}
+		if patch.Currency != nil {
+			producto.Currency = *patch.Currency
+		}
+		if patch.Stock != nil {
+			producto.Stock = *patch.Stock
+		}
+		if patch.Description != nil {
+			producto.Description = *patch.Description
+		}
+		if category != nil {
+			producto.CategoryID = category.ID
+			producto.Category = *category
+		}
+		return nil
+	})
+}
+
+// normalizeCurrency valida un código ISO-4217; vacío significa DEFAULT_CURRENCY
+func normalizeCurrency(currency string) (string, error) {
+	if currency == "" {
+		return db.DefaultCurrency(), nil
 	}
-	if newCategory != "" {
-		producto.Category = newCategory
+	currency = strings.ToUpper(currency)
+	if _, ok := models.CurrencyExponent(currency); !ok {
+		return "", fmt.Errorf("%w: unsupported currency %q", ErrInvalid, currency)
 	}
+	return currency, nil
+}
 
-	// Guarda los cambios en la base de datos
-	if err := tx.Save(&producto).Error; err != nil {
-		// Ocurrió un error al guardar en la base de datos, realiza un rollback
-		tx.Rollback()
-		return producto, err
+// whereProductRef filtra por product_id o, si ref es un número, también por el ID numérico
+func whereProductRef(tx *gorm.DB, ref string) *gorm.DB {
+	if id, err := strconv.ParseUint(ref, 10, 64); err == nil {
+		return tx.Where("product_id = ? OR id = ?", ref, id)
 	}
+	return tx.Where("product_id = ?", ref)
+}
 
-	// Confirma la transacción
-	tx.Commit()
+// ProductRef identifica el producto a modificar o borrar. Si ProductID no está
+// vacío se ignora Name.
+type ProductRef struct {
+	ProductID string // product_id o ID numérico
 
-	// Devuelve el producto actualizado
-	return producto, nil
+	// Deprecated: el nombre cambia al renombrar el producto, usar ProductID.
+	Name string
 }
 
-func generateProductID() string {
-	// Semilla para el generador aleatorio, utilizando la hora actual para mayor unicidad
-	rand.Seed(time.Now().UnixNano())
-	randomNumber := rand.Intn(1000000) // Generar un número aleatorio de 6 dígitos
-	return fmt.Sprintf("product-%d-%d", time.Now().Unix(), randomNumber)
+func (r ProductRef) validate() error {
+	if r.ProductID == "" && r.Name == "" {
+		return fmt.Errorf("%w: product_id cannot be empty", ErrInvalid)
+	}
+	return nil
 }
 
-// CreateProduct crea un nuevo producto con el nombre proporcionado
-// Si el producto ya existe, devuelve un error.
-func CreateProduct(name string, price int, stock int, description string, category string) (models.Product, error) {
-	// Verificar si el producto ya existe en la base de datos
-	var existingProduct models.Product
-	if err := db.DB.Where("name = ?", name).First(&existingProduct).Error; err == nil {
-		// Si el producto ya existe, devolver un error
-		return models.Product{}, errors.New("product with the same name already exists")
+// where filtra por la referencia
+func (r ProductRef) where(tx *gorm.DB) *gorm.DB {
+	if r.ProductID != "" {
+		return whereProductRef(tx, r.ProductID)
 	}
+	return tx.Where("name = ?", r.Name)
+}
 
+// CreateProduct crea un nuevo producto con el nombre proporcionado
+// Si el producto ya existe, devuelve un error.
+// El precio se expresa en unidades menores de currency; si currency está vacío se usa DEFAULT_CURRENCY.
+func (s *Service) CreateProduct(ctx context.Context, name string, price int64, currency string, stock int, description string, category string) (models.Product, error) {
 	// Validar los datos (opcional, pero recomendado)
 	if price <= 0 {
-		return models.Product{}, errors.New("price must be greater than zero")
+		return models.Product{}, fmt.Errorf("%w: price must be greater than zero", ErrInvalid)
+	}
+	currency, err := normalizeCurrency(currency)
+	if err != nil {
+		return models.Product{}, err
 	}
 	if stock < 0 {
-		return models.Product{}, errors.New("stock cannot be negative")
+		return models.Product{}, fmt.Errorf("%w: stock cannot be negative", ErrInvalid)
 	}
 	if description == "" {
-		return models.Product{}, errors.New("description cannot be empty")
+		return models.Product{}, fmt.Errorf("%w: description cannot be empty", ErrInvalid)
 	}
 
 	if category == "" {
-		return models.Product{}, errors.New("description cannot be empty")
+		return models.Product{}, fmt.Errorf("%w: category cannot be empty", ErrInvalid)
+	}
+	productCategory, err := s.Products.FindCategory(ctx, category)
+	if err != nil {
+		return models.Product{}, err
 	}
 
 	// Crear un nuevo producto
 	newProduct := models.Product{
 		Name:        name,
 		Price:       price,
+		Currency:    currency,
 		Stock:       stock,
 		Description: description,
-		Category: category,
+		CategoryID:  productCategory.ID,
+		Category:    productCategory,
 	}
 
-	// Generar un product_id único manualmente
-	newProduct.ProductID = generateProductID()
-
-	// Iniciar una transacción
-	tx := db.DB.Begin()
-
-	// Manejo de errores de la transacción
-	defer func() {
-		if r := recover(); r != nil {
-			tx.Rollback()
-		}
-	}()
-
-	// Intentar almacenar el nuevo producto en la base de datos
-	if err := tx.Create(&newProduct).Error; err != nil {
-		tx.Rollback() // Deshacer la transacción si hay un error
+	// Generar el product_id con el esquema configurado
+	if newProduct.ProductID, err = models.NewProductID(db.ProductIDScheme()); err != nil {
 		return models.Product{}, err
 	}
 
-	// Confirmar la transacción si no hay errores
-	tx.Commit()
+	// Guardar el producto; falla si ya existe uno con el mismo nombre, también entre los borrados
+	if err := s.Products.Create(ctx, &newProduct); err != nil {
+		return models.Product{}, err
+	}
 
 	// Devolver el producto creado
 	return newProduct, nil
 }
 
+// DeleteProductByName borra el producto con ese nombre.
+//
+// Deprecated: usar DeleteProduct con ProductRef.ProductID.
+func (s *Service) DeleteProductByName(ctx context.Context, nameProduct string) error {
+	return s.DeleteProduct(ctx, ProductRef{Name: nameProduct})
+}
 
-func DeleteProductByName(nameProduct string) error {
-	// Abre una transacción
-	tx := db.DB.Begin()
-
-	// Maneja los errores de la transacción
-	defer func() {
-		if r := recover(); r != nil {
-			tx.Rollback()
-		}
-	}()
-
-	// Busca el producto por nombre
-	var product models.Product
-	if err := tx.Where("name = ?", nameProduct).First(&product).Error; err != nil {
-		tx.Rollback() // Deshace la transacción en caso de error
-		return err
-	}
-
-	// Elimina el producto
-	if err := tx.Delete(&product).Error; err != nil {
-		tx.Rollback() // Deshace la transacción en caso de error
+// DeleteProduct borra el producto indicado por ref. Es un borrado lógico: se
+// puede restaurar hasta que lo purgue PurgeDeletedProducts
+func (s *Service) DeleteProduct(ctx context.Context, ref ProductRef) error {
+	if err := ref.validate(); err != nil {
 		return err
 	}
-
-	// Confirma la transacción si no hay errores
-	tx.Commit()
-
-	return nil
+	return s.Products.Delete(ctx, ref)
 }
 
-func EditUser(currentUsername string, newUsername string) (*models.User, error) {
-	// Buscar el usuario actual en la base de datos
-	var existingUser models.User
-	if err := db.DB.Where("username = ?", currentUsername).First(&existingUser).Error; err != nil {
+func (s *Service) EditUser(ctx context.Context, currentUsername string, newUsername string) (*models.User, error) {
+	// Buscar el usuario actual
+	existingUser, err := s.Users.FindByUsername(ctx, currentUsername)
+	if err != nil {
 		return nil, err
 	}
 
 	// Modificar el nombre de usuario
 	existingUser.Username = newUsername
 
-	// Guardar los cambios en la base de datos
-	if err := db.DB.Save(&existingUser).Error; err != nil {
+	// Guardar los cambios
+	if err := s.Users.Update(ctx, &existingUser); err != nil {
 		return nil, err
 	}
 
@@ -257,34 +251,21 @@ func EditUser(currentUsername string, newUsername string) (*models.User, error)
 	return &existingUser, nil
 }
 
-func DeleteUser(usuario string) error {
-	// Abre una transacción
-	tx := db.DB.Begin()
-
-	// Maneja los errores de la transacción
-	defer func() {
-		if r := recover(); r != nil {
-			tx.Rollback()
-		}
-	}()
+func (s *Service) DeleteUser(ctx context.Context, usuario string) error {
+	return s.Users.Delete(ctx, usuario)
+}
 
-	// Busca el producto por nombre
-	var user models.User
-	if err := tx.Where("username = ?", usuario).First(&user).Error; err != nil {
-		tx.Rollback() // Deshace la transacción en caso de error
-		return err
+// SetUserRoles reemplaza los roles del usuario
+func (s *Service) SetUserRoles(ctx context.Context, username string, roles []string) (*models.User, error) {
+	existingUser, err := s.Users.FindByUsername(ctx, username)
+	if err != nil {
+		return nil, err
 	}
 
-	// Elimina el usuario
-	if err := tx.Delete(&user).Error; err != nil {
-		tx.Rollback() // Deshace la transacción en caso de error
-		return err
+	existingUser.Roles = roles
+	if err := s.Users.Update(ctx, &existingUser); err != nil {
+		return nil, err
 	}
 
-	// Confirma la transacción si no hay errores
-	tx.Commit()
-
-	return nil
+	return &existingUser, nil
 }
-
-
@@ -0,0 +1,91 @@
+package controllers
+
+import "encoding/json"
+
+// ProductPatch es un documento estilo JSON merge patch para UpdateProduct: los
+// campos ausentes no se modifican y los presentes se aplican aunque sean 0 o "".
+// Los problemas de cada campo se acumulan al decodificar y UpdateProduct los
+// devuelve junto con los de validación en un ValidationError.
+type ProductPatch struct {
+	Name        *string `json:"name,omitempty"`
+	Price       *int64  `json:"price,omitempty"` // En unidades menores de la moneda
+	Currency    *string `json:"currency,omitempty"`
+	Stock       *int    `json:"stock,omitempty"`
+	Description *string `json:"description,omitempty"`
+	Category    *string `json:"category,omitempty"` // Slug o nombre de la categoría
+
+	problems ValidationError
+}
+
+func (p *ProductPatch) UnmarshalJSON(data []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+
+	*p = ProductPatch{}
+	for name, raw := range fields {
+		var target interface{}
+		switch name {
+		case "name":
+			target = &p.Name
+		case "price":
+			target = &p.Price
+		case "currency":
+			target = &p.Currency
+		case "stock":
+			target = &p.Stock
+		case "description":
+			target = &p.Description
+		case "category":
+			target = &p.Category
+		default:
+			p.problems.add(name, "is not a product field")
+			continue
+		}
+
+		// En un merge patch null borra el campo, y ningún campo del producto es opcional
+		if string(raw) == "null" {
+			p.problems.add(name, "cannot be null")
+			continue
+		}
+		if err := json.Unmarshal(raw, target); err != nil {
+			p.problems.add(name, "has the wrong type")
+		}
+	}
+	return nil
+}
+
+// validate comprueba los valores presentes y normaliza la moneda
+func (p *ProductPatch) validate() error {
+	problems := ValidationError{}
+	for name, problem := range p.problems.Fields {
+		problems.add(name, problem)
+	}
+
+	if p.Name != nil && *p.Name == "" {
+		problems.add("name", "cannot be empty")
+	}
+	if p.Price != nil && *p.Price <= 0 {
+		problems.add("price", "must be greater than zero")
+	}
+	if p.Currency != nil {
+		currency, err := normalizeCurrency(*p.Currency)
+		if err != nil || *p.Currency == "" {
+			problems.add("currency", "is not a supported ISO-4217 code")
+		} else {
+			p.Currency = &currency
+		}
+	}
+	if p.Stock != nil && *p.Stock < 0 {
+		problems.add("stock", "cannot be negative")
+	}
+	if p.Description != nil && *p.Description == "" {
+		problems.add("description", "cannot be empty")
+	}
+	if p.Category != nil && *p.Category == "" {
+		problems.add("category", "cannot be empty")
+	}
+
+	return problems.orNil()
+}
@@ -0,0 +1,217 @@
+package controllers
+
+import (
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/FelipeGeraldoblufus/product-microservice-go/models"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// Columnas por las que se puede ordenar FIND_ALL
+var sortColumns = map[string]string{
+	"price":   "price_minor",
+	"name":    "name",
+	"stock":   "stock",
+	"created": "created_at",
+}
+
+// ProductQuery son los filtros, el orden y la paginación de GetAllProducts.
+// Si se indica Cursor se ignora Page.
+type ProductQuery struct {
+	Page     int    `json:"page"`
+	PageSize int    `json:"pageSize"`
+	Cursor   string `json:"cursor"`
+	Category string `json:"category"` // Slug de la categoría, incluye sus subcategorías
+	MinPrice *int64 `json:"minPrice"` // En unidades menores
+	MaxPrice *int64 `json:"maxPrice"`
+	InStock  *bool  `json:"inStock"`
+	Sort     string `json:"sort"` // price, name, stock o created; con "-" delante es descendente
+}
+
+// ProductPage es una página de productos
+type ProductPage struct {
+	Items      []models.Product `json:"items"`
+	Total      int64            `json:"total"`
+	Page       int              `json:"page,omitempty"`
+	PageSize   int              `json:"pageSize"`
+	NextCursor string           `json:"nextCursor,omitempty"`
+}
+
+// productCursor apunta al último producto de una página: el valor de la
+// columna de orden y el ID para desempatar
+type productCursor struct {
+	Value string `json:"v,omitempty"`
+	ID    uint   `json:"id"`
+}
+
+// withDefaults aplica el tamaño de página por defecto y el máximo, y empieza
+// en la primera página
+func (q ProductQuery) withDefaults() ProductQuery {
+	if q.PageSize <= 0 {
+		q.PageSize = defaultPageSize
+	}
+	if q.PageSize > maxPageSize {
+		q.PageSize = maxPageSize
+	}
+	if q.Page <= 0 {
+		q.Page = 1
+	}
+	return q
+}
+
+// sortOrder devuelve la columna y la dirección pedidas en Sort
+func (q ProductQuery) sortOrder() (column string, desc bool, err error) {
+	sort := q.Sort
+	if strings.HasPrefix(sort, "-") {
+		desc = true
+		sort = sort[1:]
+	}
+	if sort == "" {
+		return "id", desc, nil
+	}
+
+	column, ok := sortColumns[sort]
+	if !ok {
+		return "", false, fmt.Errorf("%w: cannot sort by %q", ErrInvalid, q.Sort)
+	}
+	return column, desc, nil
+}
+
+// applyProductFilters añade a tx las condiciones de los filtros de q. Una
+// categoría filtra también los productos de sus subcategorías.
+func applyProductFilters(tx *gorm.DB, q ProductQuery) *gorm.DB {
+	if q.Category != "" {
+		tx = tx.Where(`category_id IN (WITH RECURSIVE tree AS (
+			SELECT id FROM categories WHERE slug = ?
+			UNION
+			SELECT c.id FROM categories c JOIN tree t ON c.parent_id = t.id
+		) SELECT id FROM tree)`, q.Category)
+	}
+	if q.MinPrice != nil {
+		tx = tx.Where("price_minor >= ?", *q.MinPrice)
+	}
+	if q.MaxPrice != nil {
+		tx = tx.Where("price_minor <= ?", *q.MaxPrice)
+	}
+	if q.InStock != nil {
+		if *q.InStock {
+			tx = tx.Where("stock > 0")
+		} else {
+			tx = tx.Where("stock <= 0")
+		}
+	}
+	return tx
+}
+
+// cursorValue devuelve el valor de la columna de orden de p como texto
+func cursorValue(p models.Product, column string) string {
+	switch column {
+	case "price_minor":
+		return strconv.FormatInt(p.Price, 10)
+	case "stock":
+		return strconv.Itoa(p.Stock)
+	case "name":
+		return p.Name
+	case "created_at":
+		return p.CreatedAt.Format(time.RFC3339Nano)
+	default:
+		return ""
+	}
+}
+
+func encodeCursor(p models.Product, column string) string {
+	raw, _ := json.Marshal(productCursor{Value: cursorValue(p, column), ID: p.ID})
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// decodeCursor devuelve un producto con el ID y el valor de la columna de
+// orden guardados en el cursor
+func decodeCursor(encoded string, column string) (models.Product, error) {
+	invalid := fmt.Errorf("%w: malformed cursor", ErrInvalid)
+
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return models.Product{}, invalid
+	}
+	var c productCursor
+	if err := json.Unmarshal(raw, &c); err != nil {
+		return models.Product{}, invalid
+	}
+
+	after := models.Product{ID: c.ID}
+	switch column {
+	case "price_minor":
+		after.Price, err = strconv.ParseInt(c.Value, 10, 64)
+	case "stock":
+		after.Stock, err = strconv.Atoi(c.Value)
+	case "created_at":
+		after.CreatedAt, err = time.Parse(time.RFC3339Nano, c.Value)
+	case "name":
+		after.Name = c.Value
+	}
+	if err != nil {
+		return models.Product{}, invalid
+	}
+	return after, nil
+}
+
+// applyCursor filtra los productos que van después del cursor según el orden
+func applyCursor(tx *gorm.DB, encoded string, column string, desc bool) (*gorm.DB, error) {
+	after, err := decodeCursor(encoded, column)
+	if err != nil {
+		return nil, err
+	}
+
+	op := ">"
+	if desc {
+		op = "<"
+	}
+	if column == "id" {
+		return tx.Where("id "+op+" ?", after.ID), nil
+	}
+
+	var value interface{}
+	switch column {
+	case "price_minor":
+		value = after.Price
+	case "stock":
+		value = after.Stock
+	case "created_at":
+		value = after.CreatedAt
+	default:
+		value = after.Name
+	}
+
+	condition := fmt.Sprintf("(%[1]s %[2]s ? OR (%[1]s = ? AND id %[2]s ?))", column, op)
+	return tx.Where(condition, value, value, after.ID), nil
+}
+
+// compareProducts compara a y b por la columna de orden y, si empatan, por ID
+func compareProducts(a models.Product, b models.Product, column string) int {
+	var c int
+	switch column {
+	case "price_minor":
+		c = cmp.Compare(a.Price, b.Price)
+	case "stock":
+		c = cmp.Compare(a.Stock, b.Stock)
+	case "name":
+		c = strings.Compare(a.Name, b.Name)
+	case "created_at":
+		c = a.CreatedAt.Compare(b.CreatedAt)
+	}
+	if c == 0 {
+		c = cmp.Compare(a.ID, b.ID)
+	}
+	return c
+}
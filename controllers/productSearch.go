@@ -0,0 +1,138 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	db "github.com/FelipeGeraldoblufus/product-microservice-go/config"
+	"github.com/FelipeGeraldoblufus/product-microservice-go/models"
+)
+
+// ProductSearch son los parámetros de SearchProducts
+type ProductSearch struct {
+	Query    string `json:"query"`
+	Language string `json:"language"` // Configuración de texto de Postgres, por defecto SEARCH_LANGUAGE
+	Prefix   *bool  `json:"prefix"`   // Si cada término coincide también como prefijo, por defecto true
+	Limit    int    `json:"limit"`
+	Offset   int    `json:"offset"`
+}
+
+// ProductSearchResult es un producto encontrado con su relevancia y los
+// fragmentos resaltados donde aparecen los términos
+type ProductSearchResult struct {
+	Product              models.Product `gorm:"embedded" json:"product"`
+	Rank                 float64        `json:"rank"`
+	NameHighlight        string         `json:"nameHighlight"`
+	DescriptionHighlight string         `json:"descriptionHighlight"`
+}
+
+// Caracteres que pueden formar parte de un término de búsqueda
+var searchTermPattern = regexp.MustCompile(`[\p{L}\p{N}]+`)
+
+// Opciones de ts_headline para los fragmentos resaltados
+const headlineOptions = "StartSel=<mark>, StopSel=</mark>, MaxWords=35, MinWords=15, HighlightAll=false"
+
+// buildTSQuery convierte el texto del usuario en una expresión de to_tsquery,
+// descartando cualquier operador para que no pueda romper la consulta
+func buildTSQuery(text string, prefix bool) string {
+	terms := searchTermPattern.FindAllString(text, -1)
+	for i, term := range terms {
+		if prefix {
+			terms[i] = term + ":*"
+		}
+	}
+	return strings.Join(terms, " & ")
+}
+
+// SearchProducts busca productos por nombre, descripción y nombre de categoría y
+// los ordena por relevancia. En Postgres usa la búsqueda de texto completo.
+func (s *Service) SearchProducts(ctx context.Context, search ProductSearch) ([]ProductSearchResult, error) {
+	language := strings.ToLower(search.Language)
+	if language == "" {
+		language = db.SearchLanguage()
+	}
+	if !db.IsSearchLanguage(language) {
+		return nil, fmt.Errorf("%w: unsupported language %q", ErrInvalid, search.Language)
+	}
+	search.Language = language
+
+	prefix := search.Prefix == nil || *search.Prefix
+	search.Prefix = &prefix
+	if buildTSQuery(search.Query, prefix) == "" {
+		return nil, fmt.Errorf("%w: query cannot be empty", ErrInvalid)
+	}
+
+	if search.Limit <= 0 {
+		search.Limit = defaultPageSize
+	}
+	if search.Limit > maxPageSize {
+		search.Limit = maxPageSize
+	}
+	if search.Offset < 0 {
+		search.Offset = 0
+	}
+
+	return s.Products.Search(ctx, search)
+}
+
+func (r *GormProductRepository) Search(ctx context.Context, search ProductSearch) ([]ProductSearchResult, error) {
+	language := search.Language
+	tsQuery := buildTSQuery(search.Query, *search.Prefix)
+
+	// La categoría está en otra tabla. Una condición OR sobre el JOIN no podría
+	// usar ningún índice, así que se unen los productos encontrados con el índice
+	// de productos y los de las categorías encontradas con el de categorías, y
+	// solo esos se ordenan. La relevancia combina los dos vectores.
+	sql := fmt.Sprintf(`WITH matches AS (
+		SELECT products.id FROM products WHERE (%[1]s) @@ to_tsquery('%[3]s', @query)
+		UNION
+		SELECT products.id FROM products WHERE products.category_id IN (
+			SELECT categories.id FROM categories WHERE (%[2]s) @@ to_tsquery('%[3]s', @query)
+		)
+	)
+	SELECT products.*,
+		ts_rank((%[1]s) || (%[2]s), q) AS rank,
+		ts_headline('%[3]s', products.name, q, @options) AS name_highlight,
+		ts_headline('%[3]s', products.description, q, @options) AS description_highlight
+	FROM matches
+	JOIN products ON products.id = matches.id
+	JOIN categories ON categories.id = products.category_id
+	CROSS JOIN to_tsquery('%[3]s', @query) q
+	WHERE products.deleted_at IS NULL
+	ORDER BY rank DESC, products.id
+	LIMIT @limit OFFSET @offset`, db.ProductSearchVector(language), db.CategorySearchVector(language), language)
+
+	results := []ProductSearchResult{}
+	err := r.db.WithContext(ctx).Raw(sql, map[string]interface{}{
+		"query":   tsQuery,
+		"options": headlineOptions,
+		"limit":   search.Limit,
+		"offset":  search.Offset,
+	}).Scan(&results).Error
+	if err != nil {
+		return nil, err
+	}
+
+	// Raw no carga asociaciones: se cargan las categorías de los resultados aparte
+	if len(results) > 0 {
+		ids := make([]uint, len(results))
+		for i, result := range results {
+			ids[i] = result.Product.CategoryID
+		}
+		var categories []models.Category
+		if err := r.db.WithContext(ctx).Where("id IN ?", ids).Find(&categories).Error; err != nil {
+			return nil, err
+		}
+		byID := make(map[uint]models.Category, len(categories))
+		for _, category := range categories {
+			byID[category.ID] = category
+		}
+		for i := range results {
+			results[i].Product.Category = byID[results[i].Product.CategoryID]
+		}
+	}
+
+	return results, nil
+}
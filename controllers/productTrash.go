@@ -0,0 +1,123 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/FelipeGeraldoblufus/product-microservice-go/models"
+	"gorm.io/gorm"
+)
+
+// DeletedProductQuery son los parámetros de ListDeletedProducts
+type DeletedProductQuery struct {
+	Page     int `json:"page"`
+	PageSize int `json:"pageSize"`
+}
+
+// withDefaults aplica el tamaño de página por defecto y el máximo, y empieza
+// en la primera página
+func (q DeletedProductQuery) withDefaults() DeletedProductQuery {
+	if q.PageSize <= 0 {
+		q.PageSize = defaultPageSize
+	}
+	if q.PageSize > maxPageSize {
+		q.PageSize = maxPageSize
+	}
+	if q.Page <= 0 {
+		q.Page = 1
+	}
+	return q
+}
+
+// ListDeletedProducts devuelve una página de productos borrados, del borrado más reciente al más antiguo
+func (s *Service) ListDeletedProducts(ctx context.Context, query DeletedProductQuery) (ProductPage, error) {
+	return s.Products.ListDeleted(ctx, query.withDefaults())
+}
+
+// RestoreProduct recupera un producto borrado, buscándolo por product_id o ID numérico
+func (s *Service) RestoreProduct(ctx context.Context, productID string) (models.Product, error) {
+	return s.Products.Restore(ctx, productID)
+}
+
+// PurgeDeletedProducts elimina definitivamente los productos borrados antes de
+// before, junto con su historial de stock y sus reservas. Devuelve cuántos eliminó.
+func (s *Service) PurgeDeletedProducts(ctx context.Context, before time.Time) (int64, error) {
+	return s.Products.PurgeDeleted(ctx, before)
+}
+
+func (r *GormProductRepository) ListDeleted(ctx context.Context, query DeletedProductQuery) (ProductPage, error) {
+	page := ProductPage{Page: query.Page, PageSize: query.PageSize}
+	deleted := r.db.WithContext(ctx).Unscoped().Model(&models.Product{}).Where("deleted_at IS NOT NULL")
+	if err := deleted.Count(&page.Total).Error; err != nil {
+		return ProductPage{}, err
+	}
+
+	products := []models.Product{}
+	err := r.db.WithContext(ctx).Unscoped().
+		Preload("Category").
+		Where("deleted_at IS NOT NULL").
+		Order("deleted_at DESC, id DESC").
+		Limit(query.PageSize).
+		Offset((query.Page - 1) * query.PageSize).
+		Find(&products).Error
+	if err != nil {
+		return ProductPage{}, err
+	}
+	page.Items = products
+
+	return page, nil
+}
+
+func (r *GormProductRepository) Restore(ctx context.Context, productID string) (models.Product, error) {
+	var product models.Product
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := whereProductRef(tx.Unscoped().Preload("Category"), productID).First(&product).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("product %w", ErrNotFound)
+		}
+		if err != nil {
+			return err
+		}
+		if !product.DeletedAt.Valid {
+			return fmt.Errorf("%w: product is not deleted", ErrInvalid)
+		}
+
+		product.DeletedAt = gorm.DeletedAt{}
+		product.Version++
+		return tx.Unscoped().Model(&product).
+			Select("deleted_at", "version").
+			Updates(&product).Error
+	})
+	if err != nil {
+		return models.Product{}, err
+	}
+
+	return product, nil
+}
+
+func (r *GormProductRepository) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	var purged int64
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var ids []uint
+		err := tx.Unscoped().Model(&models.Product{}).
+			Where("deleted_at IS NOT NULL AND deleted_at < ?", before).
+			Pluck("id", &ids).Error
+		if err != nil || len(ids) == 0 {
+			return err
+		}
+
+		if err := tx.Where("product_id IN ?", ids).Delete(&models.StockReservation{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("product_id IN ?", ids).Delete(&models.InventoryMovement{}).Error; err != nil {
+			return err
+		}
+
+		result := tx.Unscoped().Where("id IN ?", ids).Delete(&models.Product{})
+		purged = result.RowsAffected
+		return result.Error
+	})
+	return purged, err
+}
@@ -0,0 +1,135 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/FelipeGeraldoblufus/product-microservice-go/models"
+)
+
+// ProductRepository guarda los productos y resuelve sus categorías. Los errores
+// envuelven los errores base del paquete: ErrNotFound, ErrAlreadyExists,
+// ErrConflict o ErrInvalid.
+type ProductRepository interface {
+	// Find busca un producto no borrado, con su categoría
+	Find(ctx context.Context, ref ProductRef) (models.Product, error)
+
+	// List devuelve una página de productos no borrados. Una categoría en query
+	// incluye a sus subcategorías.
+	List(ctx context.Context, query ProductQuery) (ProductPage, error)
+
+	// Search busca productos no borrados por nombre, descripción y nombre de
+	// categoría, del más al menos relevante. search ya viene validada y con
+	// los valores por defecto aplicados.
+	Search(ctx context.Context, search ProductSearch) ([]ProductSearchResult, error)
+
+	// FindCategory busca una categoría por slug o por nombre. Si no existe
+	// devuelve ErrInvalid.
+	FindCategory(ctx context.Context, ref string) (models.Category, error)
+
+	// Create guarda un producto nuevo y registra su stock inicial en el
+	// historial. Devuelve ErrAlreadyExists si el nombre ya lo usa otro
+	// producto, aunque esté borrado.
+	Create(ctx context.Context, product *models.Product) error
+
+	// Update lee el producto, le aplica mutate y lo guarda con la versión
+	// siguiente. Si mutate falla no guarda nada. Devuelve ErrConflict si otro
+	// cambio se guardó mientras tanto y ErrAlreadyExists si el nombre nuevo ya
+	// está en uso. Un cambio de stock queda en el historial. mutate no debe
+	// usar el repositorio.
+	Update(ctx context.Context, ref ProductRef, mutate func(product *models.Product) error) (models.Product, error)
+
+	// Delete borra lógicamente el producto
+	Delete(ctx context.Context, ref ProductRef) error
+
+	// ListDeleted devuelve una página de productos borrados, del borrado más
+	// reciente al más antiguo. query ya trae los valores por defecto.
+	ListDeleted(ctx context.Context, query DeletedProductQuery) (ProductPage, error)
+
+	// Restore recupera un producto borrado, buscándolo por product_id o ID
+	// numérico. Devuelve ErrInvalid si no está borrado.
+	Restore(ctx context.Context, productID string) (models.Product, error)
+
+	// PurgeDeleted elimina definitivamente los productos borrados antes de
+	// before, junto con su historial de stock y sus reservas. Devuelve cuántos
+	// eliminó.
+	PurgeDeleted(ctx context.Context, before time.Time) (int64, error)
+
+	// StockHistory devuelve los movimientos de stock de un producto no
+	// borrado, del más reciente al más antiguo. query ya trae los valores por
+	// defecto.
+	StockHistory(ctx context.Context, query StockHistory) ([]models.InventoryMovement, error)
+}
+
+// CategoryRepository guarda las categorías. Los errores envuelven
+// ErrNotFound, ErrAlreadyExists o ErrInvalid.
+type CategoryRepository interface {
+	// Create guarda una categoría nueva bajo la categoría con slug parentSlug,
+	// o como raíz si está vacío. Devuelve ErrAlreadyExists si el slug está en uso.
+	Create(ctx context.Context, category *models.Category, parentSlug string) error
+
+	// List devuelve todas las categorías ordenadas por nombre
+	List(ctx context.Context) ([]models.Category, error)
+
+	// Update aplica update a la categoría con ese slug. Devuelve ErrInvalid si
+	// la nueva categoría padre es ella misma o una descendiente.
+	Update(ctx context.Context, slug string, update CategoryUpdate) (models.Category, error)
+
+	// Delete elimina una categoría. Devuelve ErrInvalid si tiene productos,
+	// aunque estén borrados, o subcategorías.
+	Delete(ctx context.Context, slug string) error
+}
+
+// InventoryRepository aplica ajustes de stock. Los errores envuelven
+// ErrNotFound o ErrInsufficientStock.
+type InventoryRepository interface {
+	// Adjust aplica todos los ajustes o ninguno y devuelve los productos
+	// modificados, ordenados por ID. Si batchID no está vacío y el lote ya se
+	// aplicó, no cambia nada y devuelve el estado actual de los productos.
+	Adjust(ctx context.Context, batchID string, adjustments []StockAdjustment) ([]models.Product, error)
+}
+
+// ReservationRepository guarda las reservas de stock de los pedidos. Los
+// errores envuelven ErrNotFound, ErrInsufficientStock o ErrInvalid.
+type ReservationRepository interface {
+	// Reserve descuenta quantities, por product_id, del stock de todos los
+	// productos o de ninguno. Si el pedido ya tiene reservas las devuelve sin
+	// cambiar nada.
+	Reserve(ctx context.Context, orderID string, quantities map[string]int, expiresAt time.Time) (Reservation, error)
+
+	// Commit confirma las reservas del pedido. Una reserva vencida se expira y
+	// devuelve ErrInvalid.
+	Commit(ctx context.Context, orderID string) (Reservation, error)
+
+	// Release cancela las reservas del pedido y devuelve el stock
+	Release(ctx context.Context, orderID string) (Reservation, error)
+
+	// Expire devuelve al stock las reservas sin confirmar que vencieron antes
+	// de now y devuelve cuántos pedidos expiraron
+	Expire(ctx context.Context, now time.Time) (int, error)
+}
+
+// UserRepository guarda los usuarios. Los errores envuelven ErrNotFound o
+// ErrAlreadyExists.
+type UserRepository interface {
+	// Create guarda un usuario nuevo; ErrAlreadyExists si el nombre está en uso
+	Create(ctx context.Context, user *models.User) error
+
+	List(ctx context.Context) ([]models.User, error)
+
+	FindByUsername(ctx context.Context, username string) (models.User, error)
+
+	// Update guarda el nombre y los roles del usuario con el ID de user
+	Update(ctx context.Context, user *models.User) error
+
+	Delete(ctx context.Context, username string) error
+}
+
+// Repositories son los repositorios que usa Service
+type Repositories struct {
+	Products     ProductRepository
+	Categories   CategoryRepository
+	Inventory    InventoryRepository
+	Reservations ReservationRepository
+	Users        UserRepository
+}
@@ -0,0 +1,309 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/FelipeGeraldoblufus/product-microservice-go/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ReservationItem es la cantidad pedida de un producto, identificado por su product_id
+type ReservationItem struct {
+	ProductID string `json:"product_id"`
+	Quantity  int    `json:"quantity"`
+}
+
+// Reservation es el estado de las reservas de un pedido
+type Reservation struct {
+	OrderID   string            `json:"order_id"`
+	Status    string            `json:"status"`
+	ExpiresAt time.Time         `json:"expires_at"`
+	Items     []ReservationItem `json:"items"`
+}
+
+// lockOrder serializa dentro de la transacción las operaciones sobre un mismo
+// pedido, para que dos RESERVE_STOCK repetidos no reserven dos veces
+func lockOrder(tx *gorm.DB, orderID string) error {
+	return tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", "reservation:"+orderID).Error
+}
+
+// orderReservations devuelve las reservas de un pedido bloqueando sus filas
+func orderReservations(tx *gorm.DB, orderID string) ([]models.StockReservation, error) {
+	var reservations []models.StockReservation
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Preload("Product", func(tx *gorm.DB) *gorm.DB { return tx.Unscoped() }).
+		Where("order_id = ?", orderID).
+		Order("product_id").
+		Find(&reservations).Error
+	return reservations, err
+}
+
+// toReservation resume las reservas de un pedido. Todas comparten estado y vencimiento.
+func toReservation(orderID string, reservations []models.StockReservation) Reservation {
+	reservation := Reservation{OrderID: orderID, Items: make([]ReservationItem, len(reservations))}
+	for i, r := range reservations {
+		reservation.Status = r.Status
+		reservation.ExpiresAt = r.ExpiresAt
+		reservation.Items[i] = ReservationItem{ProductID: r.Product.ProductID, Quantity: r.Quantity}
+	}
+	return reservation
+}
+
+// releaseStock devuelve al stock las cantidades reservadas y deja las reservas en status
+func releaseStock(tx *gorm.DB, reservations []models.StockReservation, status string) error {
+	source := models.MovementRelease
+	if status == models.ReservationExpired {
+		source = models.MovementExpire
+	}
+
+	for i := range reservations {
+		r := &reservations[i]
+		if err := adjustStock(tx, &r.Product, r.Quantity, source, "", r.OrderID); err != nil {
+			return err
+		}
+		if err := tx.Model(r).Update("status", status).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReserveStock descuenta el stock de todos los productos del pedido o de
+// ninguno. Repetir la llamada con el mismo orderID devuelve la reserva existente.
+func (s *Service) ReserveStock(ctx context.Context, orderID string, items []ReservationItem, ttl time.Duration) (Reservation, error) {
+	if orderID == "" {
+		return Reservation{}, fmt.Errorf("%w: order id cannot be empty", ErrInvalid)
+	}
+	if len(items) == 0 {
+		return Reservation{}, fmt.Errorf("%w: reservation must have at least one item", ErrInvalid)
+	}
+
+	// Agrupa las cantidades por producto
+	quantities := make(map[string]int)
+	for _, item := range items {
+		if item.ProductID == "" {
+			return Reservation{}, fmt.Errorf("%w: product id cannot be empty", ErrInvalid)
+		}
+		if item.Quantity <= 0 {
+			return Reservation{}, fmt.Errorf("%w: quantity must be greater than zero", ErrInvalid)
+		}
+		quantities[item.ProductID] += item.Quantity
+	}
+
+	return s.Reservations.Reserve(ctx, orderID, quantities, time.Now().Add(ttl))
+}
+
+// CommitReservation confirma las reservas de un pedido; el stock ya descontado
+// no vuelve. Confirmar un pedido ya confirmado no hace nada.
+func (s *Service) CommitReservation(ctx context.Context, orderID string) (Reservation, error) {
+	return s.Reservations.Commit(ctx, orderID)
+}
+
+// ReleaseReservation cancela las reservas de un pedido y devuelve el stock.
+// Liberar un pedido ya liberado o vencido no hace nada.
+func (s *Service) ReleaseReservation(ctx context.Context, orderID string) (Reservation, error) {
+	return s.Reservations.Release(ctx, orderID)
+}
+
+// ExpireReservations devuelve al stock las reservas sin confirmar que vencieron
+// antes de now y devuelve cuántos pedidos expiraron
+func (s *Service) ExpireReservations(ctx context.Context, now time.Time) (int, error) {
+	return s.Reservations.Expire(ctx, now)
+}
+
+// GormReservationRepository guarda las reservas en Postgres. Las operaciones
+// sobre un pedido se serializan con un advisory lock.
+type GormReservationRepository struct {
+	db *gorm.DB
+}
+
+func NewGormReservationRepository(database *gorm.DB) *GormReservationRepository {
+	return &GormReservationRepository{db: database}
+}
+
+func (r *GormReservationRepository) Reserve(ctx context.Context, orderID string, quantities map[string]int, expiresAt time.Time) (Reservation, error) {
+	var reservations []models.StockReservation
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := lockOrder(tx, orderID); err != nil {
+			return err
+		}
+
+		var err error
+		if reservations, err = orderReservations(tx, orderID); err != nil {
+			return err
+		}
+		if len(reservations) > 0 {
+			return nil
+		}
+
+		productIDs := make([]string, 0, len(quantities))
+		for productID := range quantities {
+			productIDs = append(productIDs, productID)
+		}
+		var products []models.Product
+		if err := tx.Where("product_id IN ?", productIDs).Find(&products).Error; err != nil {
+			return err
+		}
+		if len(products) != len(productIDs) {
+			found := make(map[string]bool, len(products))
+			for _, product := range products {
+				found[product.ProductID] = true
+			}
+			for _, productID := range productIDs {
+				if !found[productID] {
+					return fmt.Errorf("product %q %w", productID, ErrNotFound)
+				}
+			}
+		}
+
+		// Se descuenta siempre en el mismo orden para evitar interbloqueos entre pedidos
+		sort.Slice(products, func(i, j int) bool { return products[i].ID < products[j].ID })
+
+		for _, product := range products {
+			quantity := quantities[product.ProductID]
+			if err := adjustStock(tx, &product, -quantity, models.MovementReserve, "", orderID); err != nil {
+				return err
+			}
+
+			reservations = append(reservations, models.StockReservation{
+				OrderID:   orderID,
+				ProductID: product.ID,
+				Product:   product,
+				Quantity:  quantity,
+				Status:    models.ReservationReserved,
+				ExpiresAt: expiresAt,
+			})
+		}
+
+		return tx.Omit(clause.Associations).Create(&reservations).Error
+	})
+	if err != nil {
+		return Reservation{}, err
+	}
+
+	return toReservation(orderID, reservations), nil
+}
+
+func (r *GormReservationRepository) Commit(ctx context.Context, orderID string) (Reservation, error) {
+	var reservations []models.StockReservation
+	expired := false
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := lockOrder(tx, orderID); err != nil {
+			return err
+		}
+
+		var err error
+		if reservations, err = orderReservations(tx, orderID); err != nil {
+			return err
+		}
+		if len(reservations) == 0 {
+			return fmt.Errorf("reservation for order %q %w", orderID, ErrNotFound)
+		}
+
+		switch reservations[0].Status {
+		case models.ReservationCommitted:
+			return nil
+		case models.ReservationReserved:
+		default:
+			return fmt.Errorf("%w: reservation for order %q is %s", ErrInvalid, orderID, reservations[0].Status)
+		}
+
+		// Una reserva vencida que el barrido aún no procesó se expira aquí
+		if !reservations[0].ExpiresAt.After(time.Now()) {
+			expired = true
+			return releaseStock(tx, reservations, models.ReservationExpired)
+		}
+
+		return tx.Model(&models.StockReservation{}).
+			Where("order_id = ?", orderID).
+			Update("status", models.ReservationCommitted).Error
+	})
+	if err != nil {
+		return Reservation{}, err
+	}
+	if expired {
+		return Reservation{}, fmt.Errorf("%w: reservation for order %q is %s", ErrInvalid, orderID, models.ReservationExpired)
+	}
+
+	for i := range reservations {
+		reservations[i].Status = models.ReservationCommitted
+	}
+	return toReservation(orderID, reservations), nil
+}
+
+func (r *GormReservationRepository) Release(ctx context.Context, orderID string) (Reservation, error) {
+	var reservations []models.StockReservation
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := lockOrder(tx, orderID); err != nil {
+			return err
+		}
+
+		var err error
+		if reservations, err = orderReservations(tx, orderID); err != nil {
+			return err
+		}
+		if len(reservations) == 0 {
+			return fmt.Errorf("reservation for order %q %w", orderID, ErrNotFound)
+		}
+
+		switch reservations[0].Status {
+		case models.ReservationReleased, models.ReservationExpired:
+			return nil
+		case models.ReservationCommitted:
+			return fmt.Errorf("%w: reservation for order %q is already committed", ErrInvalid, orderID)
+		}
+
+		return releaseStock(tx, reservations, models.ReservationReleased)
+	})
+	if err != nil {
+		return Reservation{}, err
+	}
+
+	return toReservation(orderID, reservations), nil
+}
+
+// Expire procesa cada pedido vencido en su propia transacción
+func (r *GormReservationRepository) Expire(ctx context.Context, now time.Time) (int, error) {
+	var orderIDs []string
+	err := r.db.WithContext(ctx).Model(&models.StockReservation{}).
+		Where("status = ? AND expires_at <= ?", models.ReservationReserved, now).
+		Distinct().
+		Pluck("order_id", &orderIDs).Error
+	if err != nil {
+		return 0, err
+	}
+
+	expired := 0
+	for _, orderID := range orderIDs {
+		released := false
+		err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if err := lockOrder(tx, orderID); err != nil {
+				return err
+			}
+
+			reservations, err := orderReservations(tx, orderID)
+			if err != nil {
+				return err
+			}
+			// Otra operación pudo confirmar o liberar el pedido mientras tanto
+			if len(reservations) == 0 || reservations[0].Status != models.ReservationReserved {
+				return nil
+			}
+
+			released = true
+			return releaseStock(tx, reservations, models.ReservationExpired)
+		})
+		if err != nil {
+			return expired, err
+		}
+		if released {
+			expired++
+		}
+	}
+
+	return expired, nil
+}
@@ -0,0 +1,54 @@
+package internal
+
+import (
+	"context"
+
+	"github.com/FelipeGeraldoblufus/product-microservice-go/models"
+)
+
+type createCategoryRequest struct {
+	Name   string `json:"name"`
+	Slug   string `json:"slug"`   // Opcional, por defecto se genera a partir del nombre
+	Parent string `json:"parent"` // Slug de la categoría padre, vacío para una categoría raíz
+}
+
+type listCategoriesRequest struct {
+	Tree bool `json:"tree"`
+}
+
+type editCategoryRequest struct {
+	Slug      string  `json:"slug"`
+	NewName   string  `json:"newName"`
+	NewSlug   string  `json:"newSlug"`
+	NewParent *string `json:"newParent"` // "" convierte la categoría en raíz, ausente no la mueve
+}
+
+type deleteCategoryRequest struct {
+	Slug string `json:"slug"`
+}
+
+func registerCategoryRoutes(r *Router, h *Handler) {
+	Register(r, "CREATE_CATEGORY", Messages{"Category created", "Error creating category"}, h.createCategory)
+	Register(r, "LIST_CATEGORIES", Messages{"Categories retrieved", "Error getting categories"}, h.listCategories)
+	Register(r, "EDIT_CATEGORY", Messages{"Category updated", "Error updating category"}, h.editCategory)
+	Register(r, "DELETE_CATEGORY", Messages{"Category deleted", "Error deleting category"}, h.deleteCategory)
+}
+
+func (h *Handler) createCategory(ctx context.Context, req createCategoryRequest) (models.Category, error) {
+	return h.service.CreateCategory(ctx, req.Name, req.Slug, req.Parent)
+}
+
+func (h *Handler) listCategories(ctx context.Context, req listCategoriesRequest) ([]models.Category, error) {
+	return h.service.ListCategories(ctx, req.Tree)
+}
+
+func (h *Handler) editCategory(ctx context.Context, req editCategoryRequest) (models.Category, error) {
+	if req.Slug == "" {
+		return models.Category{}, &Error{Code: CodeBadRequest, Message: "Category slug cannot be empty"}
+	}
+	return h.service.UpdateCategory(ctx, req.Slug, req.NewName, req.NewSlug, req.NewParent)
+}
+
+func (h *Handler) deleteCategory(ctx context.Context, req deleteCategoryRequest) (Empty, error) {
+	return Empty{}, h.service.DeleteCategory(ctx, req.Slug)
+}
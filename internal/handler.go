@@ -3,543 +3,257 @@ package internal
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"runtime/debug"
+	"strconv"
 	"time"
 
-	//"github.com/ValeHenriquez/example-rabbit-go/tasks-server/controllers"
-	//"github.com/ValeHenriquez/example-rabbit-go/tasks-server/models"
+	"github.com/FelipeGeraldoblufus/product-microservice-go/config"
 	"github.com/FelipeGeraldoblufus/product-microservice-go/controllers"
 	"github.com/FelipeGeraldoblufus/product-microservice-go/models"
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
-func failOnError(err error, msg string) {
-	if err != nil {
-		log.Panicf("%s: %s", msg, err)
-	}
+// Envelope es el formato de los mensajes recibidos en la cola
+type Envelope struct {
+	Pattern  string          `json:"pattern"`
+	Data     json.RawMessage `json:"data"`
+	ID       string          `json:"id"`
+	Headers  models.Headers  `json:"headers"`
+	Deadline *time.Time      `json:"deadline"` // Opcional, RFC 3339. Después de esta hora el cliente ya no espera la respuesta
 }
 
-func Handler(d amqp.Delivery, ch *amqp.Channel) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+// Plazo de una petición que no trae deadline ni expiración
+const requestTimeout = 5 * time.Second
 
-	var response models.Response
-	log.Println(" [.] Received a message")
+// Plazo para publicar la respuesta, independiente del de la petición para
+// poder avisar al cliente de que se agotó
+const replyTimeout = 5 * time.Second
 
-	var Payload struct {
-		Pattern string          `json:"pattern"`
-		Data    json.RawMessage `json:"data"`
-		ID      string          `json:"id"`
+// deadline devuelve el plazo pedido por el cliente: el deadline del sobre o,
+// si no viene, la expiración AMQP contada desde que se publicó el mensaje
+func (e Envelope) deadline(d amqp.Delivery, received time.Time) (time.Time, bool) {
+	if e.Deadline != nil {
+		return *e.Deadline, true
+	}
+	// Un mensaje reintentado trae la expiración original en una cabecera
+	expiration := d.Expiration
+	if original, ok := d.Headers[expirationHeader].(string); ok {
+		expiration = original
+	}
+	if expiration == "" {
+		return time.Time{}, false
 	}
-	var err error
-	err = json.Unmarshal(d.Body, &Payload)
-
-	actionType := Payload.Pattern
-
-	//dataJSON, err := json.Marshal(Payload.Data)
-	failOnError(err, "Failed to marshal data")
-	switch actionType {
-	case "GET_PRODUCT":
-		log.Println(" [.] Getting product by ID")
-	
-		var err error
-		var productJson []byte
-		var product models.Product
-	
-		// Aquí, Payload.Data debería ser solo un número (ID)
-		log.Printf("Received Payload: %s", Payload.Data)
-	
-		// Convertir el Payload.Data a uint (ID del producto)
-		var productID string
-		if err := json.Unmarshal(Payload.Data, &productID); err != nil {
-			log.Printf("Error unmarshalling data: %v", err)
-			response = models.Response{
-				Success: "error",
-				Message: "Error parsing request data",
-				Data:    []byte(err.Error()),
-			}
-			break
-		}
-	
-		log.Printf("Searching for product with ID: %d", productID)
-	
-		// Llamar a la función para obtener el producto por ID
-		product, err = controllers.GetByProductID(productID)
-		if err != nil {
-			// Si no se encuentra el producto o ocurre otro error
-			log.Printf("Error getting product by ID: %v", err)
-			response = models.Response{
-				Success: "error",
-				Message: "Error getting product",
-				Data:    []byte(err.Error()),
-			}
-		} else {
-			// Si todo está bien, devolver el producto en formato JSON
-			productJson, err = json.Marshal(product) // Serializar el producto a JSON
-			if err != nil {
-				log.Printf("Error serializing product: %v", err)
-				response = models.Response{
-					Success: "error",
-					Message: "Error serializing product",
-					Data:    []byte(err.Error()),
-				}
-			} else {
-				// Enviar la respuesta con el producto serializado como JSON
-				response = models.Response{
-					Success: "success",
-					Message: "Product retrieved",
-					Data:    productJson, // Enviar los datos como JSON
-				}
-			}
-		}
-
-
-	case "FIND_ALL":
-		log.Println(" [.] Getting all products")
-		
-		var err error
-		var productsJson []byte
-		var products []models.Product
-		
-		// Llamar a la función para obtener todos los productos
-		products, err = controllers.GetAllProducts()
-		if err != nil {
-			// Si ocurre un error al obtener los productos
-			log.Printf("Error getting all products: %v", err)
-			response = models.Response{
-				Success: "error",
-				Message: "Error getting products",
-				Data:    []byte(err.Error()),
-			}
-		} else {
-			// Si todo está bien, devolver los productos en formato JSON
-			productsJson, err = json.Marshal(products) // Serializar los productos a JSON
-			if err != nil {
-				log.Printf("Error serializing products: %v", err)
-				response = models.Response{
-					Success: "error",
-					Message: "Error serializing products",
-					Data:    []byte(err.Error()),
-				}
-			} else {
-				// Enviar la respuesta con los productos serializados como JSON
-				response = models.Response{
-					Success: "success",
-					Message: "Products retrieved",
-					Data:    productsJson, // Enviar los datos como JSON
-				}
-			}
-		}
-	
-	
-
-	case "GET_USERBYNAME":
-		log.Println(" [.] Getting product by Name")
-		var data struct {
-			Name string `json:"username"`
-		}
-		var err error
-		var userJson []byte
-		var users models.User
 
-		err = json.Unmarshal(Payload.Data, &data)
-		users, err = controllers.GetByUser(data.Name)
+	ms, err := strconv.ParseInt(expiration, 10, 64)
+	if err != nil {
+		log.Printf("Ignoring invalid AMQP expiration %q", expiration)
+		return time.Time{}, false
+	}
+	published := received
+	if !d.Timestamp.IsZero() {
+		published = d.Timestamp
+	}
+	return published.Add(time.Duration(ms) * time.Millisecond), true
+}
 
-		userJson, err = json.Marshal(users)
-		if err != nil {
-			response = models.Response{
-				Success: "error",
-				Message: "Error getting product",
-				Data:    []byte(err.Error()),
-			}
-		} else {
-			response = models.Response{
-				Success: "succes",
-				Message: "Product retrieved",
-				Data:    userJson,
-			}
-		}
+// token devuelve el token del sobre o, si no viene, el de la cabecera AMQP Authorization
+func (e Envelope) token(d amqp.Delivery) string {
+	if e.Headers.Authorization != "" {
+		return e.Headers.Authorization
+	}
+	token, _ := d.Headers["Authorization"].(string)
+	return token
+}
 
-	case "EDIT_PRODUCT":
-		log.Println(" [.] Editing product by Name")
-	
-		// Cambiar la estructura para reflejar el JSON con 'updateDTO'
-		var data struct {
-			UpdateDTO struct {
-				Product        string `json:"product"`
-				NewNameProduct string `json:"newnameProduct"`
-				NewPrice       int    `json:"newPrice"`
-				NewStock       int    `json:"newStock"`
-				NewDescription string `json:"newDescription"`
-				NewCategory    string `json:"newCategory"`
-			} `json:"updateDTO"`
-		}
-	
-		var err error
-		var userJson []byte
-		var producto models.Product
-	
-		// Log para verificar los datos antes de deserializar
-		log.Printf("Received data before unmarshalling: %s", string(Payload.Data))
-	
-		// Decodificar los datos recibidos
-		err = json.Unmarshal(Payload.Data, &data)
-		if err != nil {
-			log.Printf("Error unmarshalling JSON: %v", err)
-			response = models.Response{
-				Success: "error",
-				Message: "Error decoding JSON",
-				Data:    []byte(err.Error()),
-			}
-			break
-		}
-	
-		// Log para verificar los datos después del unmarshalling
-		log.Printf("Decoded data: %+v", data)
-	
-		// Verificar que el campo 'Product' no esté vacío
-		if data.UpdateDTO.Product == "" {
-			log.Println("Error: product name is empty")
-			response = models.Response{
-				Success: "error",
-				Message: "Product name cannot be empty",
-				Data:    []byte("Product name cannot be empty"),
-			}
-			break
-		}
-	
-		// Llamada a la función para actualizar el producto
-		producto, err = controllers.UpdateProduct(
-			data.UpdateDTO.Product, 
-			data.UpdateDTO.NewNameProduct, 
-			data.UpdateDTO.NewPrice, 
-			data.UpdateDTO.NewStock, 
-			data.UpdateDTO.NewDescription, 
-			data.UpdateDTO.NewCategory,
-		)
-		if err != nil {
-			log.Printf("Error updating product: %v", err)
-			response = models.Response{
-				Success: "error",
-				Message: "Error updating product",
-				Data:    []byte(err.Error()),
-			}
-			break
-		}
-	
-		// Convertir el resultado a JSON y preparar la respuesta
-		userJson, err = json.Marshal(producto)
-		if err != nil {
-			log.Printf("Error marshaling JSON: %v", err)
-			response = models.Response{
-				Success: "error",
-				Message: "Error marshaling JSON",
-				Data:    []byte(err.Error()),
-			}
-		} else {
-			log.Printf("Product updated successfully: %+v", producto)
-			response = models.Response{
-				Success: "success",
-				Message: "Product updated",
-				Data:    userJson,
-			}
-		}
-	
-	
-	case "CREATE_PRODUCT":
-		log.Println(" [.] Creating product")
-	
-		// Estructura para deserializar los datos recibidos
-		var data struct {
-			Name        string  `json:"name"`
-			Price       int `json:"price"`
-			Stock       int     `json:"stock"`
-			Description string  `json:"description"`
-			Category string `json:"category"` 
-		}
-	
-		var err error
-		var dataJson []byte
-		var product models.Product
-	
-		// Log de depuración para verificar los datos recibidos
-		log.Printf("Received data: %+v\n", Payload.Data)
-	
-		// Deserializar el payload JSON
-		err = json.Unmarshal(Payload.Data, &data)
-		if err != nil {
-			response = models.Response{
-				Success: "error",
-				Message: "Error decoding JSON",
-				Data:    []byte(err.Error()),
-			}
-			break
-		}
-	
-		// Crear el producto utilizando los datos deserializados
-		product, err = controllers.CreateProduct(data.Name, data.Price, data.Stock, data.Description, data.Category)
-		if err != nil {
-			response = models.Response{
-				Success: "error",
-				Message: "Error creating product",
-				Data:    []byte(err.Error()),
-			}
-			break
-		}
-	
-		// Serializar el producto creado a JSON
-		dataJson, err = json.Marshal(product)
-		if err != nil {
-			response = models.Response{
-				Success: "error",
-				Message: "Error marshaling JSON",
-				Data:    []byte(err.Error()),
-			}
-		} else {
-			response = models.Response{
-				Success: "success",
-				Message: "Product created",
-				Data:    dataJson,
-			}
-		}
-	
+// Handler atiende las peticiones RPC. Todos los patrones y la autorización
+// usan el controllers.Service recibido; con los repositorios en memoria se
+// pueden probar con Dispatch sin Postgres ni RabbitMQ.
+type Handler struct {
+	service *controllers.Service
+	router  *Router
+}
 
-	case "DELETE_PRODUCT":
-		log.Println(" [.] Deleting product")
-		var data struct {
-			Name string `json:"name"`
-		}
-		var err error
-		var dataJson []byte
-		var product models.Product
-		// Log de depuración para verificar los datos recibidos
-		log.Printf("Received data: %+v\n", data.Name)
+func NewHandler(service *controllers.Service) *Handler {
+	h := &Handler{service: service}
+	h.router = h.newRouter()
+	return h
+}
 
-		err = json.Unmarshal(Payload.Data, &data)
-		if err != nil {
-			response = models.Response{
-				Success: "error",
-				Message: "Error decoding JSON",
-				Data:    []byte(err.Error()),
-			}
-			break
-		}
+// newRouter crea el router con todos los patrones soportados por el servicio
+func (h *Handler) newRouter() *Router {
+	r := NewRouter()
+	registerProductRoutes(r, h)
+	registerUserRoutes(r, h)
+	registerCategoryRoutes(r, h)
+	registerReservationRoutes(r, h)
+	registerInventoryRoutes(r, h)
+	return r
+}
 
-		err = controllers.DeleteProductByName(data.Name)
-		if err != nil {
-			response = models.Response{
-				Success: "error",
-				Message: "Error Deleting product",
-				Data:    []byte(err.Error()),
-			}
-			break
-		}
-		dataJson, err = json.Marshal(product)
-		if err != nil {
-			response = models.Response{
-				Success: "error",
-				Message: "Error marshaling JSON",
-				Data:    []byte(err.Error()),
-			}
-		} else {
-			response = models.Response{
-				Success: "success",
-				Message: "Product deleted",
-				Data:    dataJson,
-			}
-		}
+// Dispatch autentica la petición con token y ejecuta el patrón. Si ctx vence
+// antes de empezar responde con CodeTimeout.
+func (h *Handler) Dispatch(ctx context.Context, pattern string, token string, data json.RawMessage) models.Response {
+	response, _ := h.dispatch(ctx, pattern, token, data)
+	return response
+}
 
-	case "EDIT_USER":
-		log.Println(" [.] Editing user")
-		var data struct {
-			CurrentUsername string `json:"currentUsername"`
-			NewUsername     string `json:"newUsername"`
-		}
-		var err error
-		// Log de depuración para verificar los datos recibidos
-		log.Printf("Received data: %+v\n", data.CurrentUsername, data.NewUsername)
+// dispatch es Dispatch, pero si la petición falla devuelve también el error
+// que lo causó
+func (h *Handler) dispatch(ctx context.Context, pattern string, token string, data json.RawMessage) (models.Response, error) {
+	ctx, err := h.authenticate(ctx, pattern, token)
+	switch {
+	case ctx.Err() != nil:
+		log.Printf("Deadline of %s exceeded before handling it", pattern)
+		return errorResponse(CodeTimeout, timeoutMessage, ctx.Err()), ctx.Err()
+	case err != nil:
+		log.Printf("Rejected %s: %v", pattern, err)
+		code, message := describeError(err, "Unauthorized")
+		return errorResponse(code, message, err), err
+	default:
+		return h.router.Dispatch(ctx, pattern, data)
+	}
+}
 
-		err = json.Unmarshal(Payload.Data, &data)
-		if err != nil {
-			response = models.Response{
-				Success: "error",
-				Message: "Error decoding JSON",
-				Data:    []byte(err.Error()),
-			}
-			break
+// Handle procesa un mensaje de la cola, publica la respuesta en ReplyTo y
+// confirma la entrega. Nunca entra en pánico. Los pánicos y los fallos
+// transitorios de la base de datos se reintentan hasta terminar en la DLQ si
+// repetir la petición es seguro (ver replayable); si no, se responde el error.
+func (h *Handler) Handle(d amqp.Delivery, pub *Publisher) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Recovered from panic while handling message: %v\n%s", r, debug.Stack())
+			retryOrDeadLetter(pub, d, fmt.Errorf("panic: %v", r))
 		}
+	}()
 
-		// Llama a la función para editar el usuario
-		_, err = controllers.EditUser(data.CurrentUsername, data.NewUsername)
-		if err != nil {
-			response = models.Response{
-				Success: "error",
-				Message: "Error editing user",
-				Data:    []byte(err.Error()),
-			}
-			break
-		}
+	received := time.Now()
+	log.Println(" [.] Received a message")
 
-		response = models.Response{
-			Success: "success",
-			Message: "User edited successfully",
-			Data:    nil, // No necesitas enviar datos específicos en la respuesta
+	var payload Envelope
+	if err := json.Unmarshal(d.Body, &payload); err != nil {
+		log.Printf("Malformed message: %v", err)
+		if err := reply(pub, d, errorResponse(CodeBadRequest, "Malformed message", err)); err != nil {
+			log.Printf("Failed to publish a message: %v", err)
 		}
+		settleMalformed(d)
+		return
+	}
 
-	case "CREATE_USER":
-		log.Println(" [.] Creating user")
-		var data struct {
-			Username string `json:"username"`
-		}
-		var err error
+	// Los controladores cancelan sus consultas cuando vence el plazo
+	deadline := received.Add(requestTimeout)
+	if requested, ok := payload.deadline(d, received); ok {
+		deadline = requested
+	}
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
 
-		// Log de depuración para verificar los datos recibidos
-		log.Printf("Received data: %+v\n", data)
+	response, err := h.dispatch(ctx, payload.Pattern, payload.token(d), payload.Data)
 
-		err = json.Unmarshal(Payload.Data, &data)
-		if err != nil {
-			response = models.Response{
-				Success: "error",
-				Message: "Error decoding JSON",
-				Data:    []byte(err.Error()),
+	// El mensaje se reintenta y, en el último intento, el cliente recibe el
+	// error antes de que vaya a la DLQ
+	if replayable(payload.Pattern, response, err) {
+		cause := fmt.Errorf("%s: %w", response.Code, err)
+		if lastAttempt(d) {
+			if err := reply(pub, d, response); err != nil {
+				log.Printf("Failed to publish a message: %v", err)
 			}
-			break
 		}
+		retryOrDeadLetter(pub, d, cause)
+		return
+	}
 
-		// Verificar que el campo necesario (username) no esté vacío
-		if data.Username == "" {
-			response = models.Response{
-				Success: "error",
-				Message: "Username is required",
-				Data:    nil,
-			}
-			break
-		}
+	if err := reply(pub, d, response); err != nil {
+		log.Printf("Failed to publish a message: %v", err)
+		settleFailedReply(pub, d, response, err)
+		return
+	}
 
-		// Llama a la función para crear el usuario
-		createdUser, err := controllers.CreateUser(data.Username)
-		if err != nil {
-			response = models.Response{
-				Success: "error",
-				Message: "Error creating user",
-				Data:    []byte(err.Error()),
-			}
-			break
-		}
+	if err := d.Ack(false); err != nil {
+		log.Printf("Failed to ack message: %v", err)
+	}
+}
 
-		// Convertir createdUser a formato JSON y luego a []byte
-		userData, err := json.Marshal(createdUser)
-		if err != nil {
-			response = models.Response{
-				Success: "error",
-				Message: "Error encoding user data",
-				Data:    []byte(err.Error()),
-			}
+// settleFailedReply decide qué hacer con la petición cuando su respuesta no fue
+// confirmada o no se pudo enrutar, según REPLY_FAILURE_POLICY. La petición ya
+// se procesó, así que nunca se vuelve a ejecutar: solo se reintenta la respuesta.
+func settleFailedReply(pub *Publisher, d amqp.Delivery, response models.Response, cause error) {
+	var err error
+	switch config.ReplyFailurePolicy() {
+	case config.ReplyFailureLog:
+		log.Printf("Dropping reply to %q: %v", d.ReplyTo, cause)
+		err = d.Ack(false)
+	case config.ReplyFailureDeadLetter:
+		log.Printf("Sending request to dead letter queue, reply to %q failed: %v", d.ReplyTo, cause)
+		err = d.Nack(false, false)
+	default:
+		if cause = retryReply(pub, d, response, cause); cause == nil {
+			err = d.Ack(false)
 			break
 		}
+		log.Printf("Sending request to dead letter queue, reply to %q failed: %v", d.ReplyTo, cause)
+		err = d.Nack(false, false)
+	}
+	if err != nil {
+		log.Printf("Failed to settle message: %v", err)
+	}
+}
 
-		response = models.Response{
-			Success: "success",
-			Message: "User created successfully",
-			Data:    userData,
-		}
-
-	case "DELETE_USER":
-		log.Println(" [.] Deleting user")
-		var data struct {
-			Username string `json:"username"`
-		}
-		var err error
-		// Log de depuración para verificar los datos recibidos
-		log.Printf("Received data: %+v\n", data.Username)
-
-		err = json.Unmarshal(Payload.Data, &data)
-		if err != nil {
-			response = models.Response{
-				Success: "error",
-				Message: "Error decoding JSON",
-				Data:    []byte(err.Error()),
-			}
-			break
-		}
+// Espera antes del primer reintento de una respuesta; se duplica en cada intento
+const replyRetryBackoff = 200 * time.Millisecond
 
-		// Llama a la función para eliminar el CartItem
-		err = controllers.DeleteUser(data.Username)
-		if err != nil {
-			response = models.Response{
-				Success: "error",
-				Message: "Error deleting cartitem",
-				Data:    []byte(err.Error()),
-			}
-			break
+// retryReply vuelve a publicar la respuesta ya calculada hasta completar
+// MAX_DELIVERY_ATTEMPTS intentos. Devuelve el último error, o nil si se publicó.
+func retryReply(pub *Publisher, d amqp.Delivery, response models.Response, cause error) error {
+	backoff := replyRetryBackoff
+	for attempt := 2; attempt <= config.MaxDeliveryAttempts(); attempt++ {
+		// Si la cola de respuesta no existe, reintentar no cambia nada
+		if errors.Is(cause, ErrReturned) {
+			return cause
 		}
 
-		response = models.Response{
-			Success: "success",
-			Message: "User deleted successfully",
-			Data:    nil, // No necesitas enviar datos específicos en la respuesta
+		time.Sleep(backoff)
+		backoff *= 2
+		log.Printf("Retrying reply to %q (attempt %d): %v", d.ReplyTo, attempt, cause)
+		if cause = reply(pub, d, response); cause == nil {
+			return nil
 		}
+	}
+	return cause
+}
 
-	case "CREATE_CATEGORY":
-		log.Println(" [.] Creating category")
-		//log.Println("data ", Payload.Data.Data)
-		//log.Println("data JSON", dataJSON)
-
-		/*var category models.Category
-		err := json.Unmarshal(Payload.Data.Data, &category)
-		failOnError(err, "Failed to unmarshal category")
-
-		log.Println("category ", category)
-
-		categoryJson, err := json.Marshal(category)
-		failOnError(err, "Failed to marshal category")
-
-		//err = json.Unmarshal(categoryJson, &category)
-
-		_, err = controllers.CreateCategory(category)
-		if err != nil {
-			response = models.Response{
-				Success: "error",
-				Message: "Error creating category",
-				Data:    []byte(err.Error()),
-			}
-		} else {
-			response = models.Response{
-				Success: "succes",
-				Message: "Category created",
-				Data:    categoryJson,
-			}
-		}*/
-
-		/*case "GET_TOP3POPULARPRODUCTS":
-		log.Println(" [.] Getting top 3 popular products")
-
-		products, err := controllers.GetTop3PopularProducts()
-		failOnError(err, "Failed to get products")
-		productsJSON, err := json.Marshal(products)
-		failOnError(err, "Failed to marshal products")
-
-		response = models.Response{
-			Success: "succes",
-			Message: "Products retrieved",
-			Data:    productsJSON,
-		}*/
+// reply publica la respuesta en la cola ReplyTo del mensaje, si existe
+func reply(pub *Publisher, d amqp.Delivery, response models.Response) error {
+	if d.ReplyTo == "" {
+		return nil
 	}
 
+	ctx, cancel := context.WithTimeout(context.Background(), replyTimeout)
+	defer cancel()
+
 	responseJSON, err := json.Marshal(response)
-	failOnError(err, "Failed to marshal response")
+	if err != nil {
+		return err
+	}
 
-	err = ch.PublishWithContext(ctx,
-		"",        // exchange
-		d.ReplyTo, // routing key
-		false,     // mandatory
-		false,     // immediate
-		amqp.Publishing{
-			ContentType:   "application/json",
-			CorrelationId: d.CorrelationId,
-			Body:          responseJSON,
-		})
-	failOnError(err, "Failed to publish a message")
+	return pub.Publish(ctx, "", d.ReplyTo, amqp.Publishing{
+		ContentType:   "application/json",
+		CorrelationId: d.CorrelationId,
+		Body:          responseJSON,
+	})
+}
 
-	d.Ack(false)
+// settleMalformed confirma o rechaza un mensaje mal formado según MALFORMED_MESSAGE_POLICY
+func settleMalformed(d amqp.Delivery) {
+	var err error
+	if config.MalformedMessagePolicy() == config.MalformedAck {
+		err = d.Ack(false)
+	} else {
+		err = d.Reject(false)
+	}
+	if err != nil {
+		log.Printf("Failed to settle malformed message: %v", err)
+	}
 }
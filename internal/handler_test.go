@@ -0,0 +1,296 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/FelipeGeraldoblufus/product-microservice-go/controllers"
+	"github.com/FelipeGeraldoblufus/product-microservice-go/models"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testSecret = "test-secret"
+
+// newTestHandler arma un Handler sobre repositorios en memoria con una
+// categoría "ropa", la merchant "mia" y el usuario sin roles "pepe"
+func newTestHandler(t *testing.T) *Handler {
+	t.Helper()
+	t.Setenv("JWT_SECRET", testSecret)
+
+	repositories := controllers.NewMemoryRepositories(models.Category{Slug: "ropa", Name: "Ropa"})
+	repositories.Users = controllers.NewMemoryUserRepository(
+		models.User{Username: "mia", Roles: models.Roles{models.RoleMerchant}},
+		models.User{Username: "pepe"},
+	)
+	return NewHandler(controllers.NewService(repositories))
+}
+
+// token firma un token para sub que vence en expiresIn; sin "exp" si expiresIn es 0
+func token(t *testing.T, sub string, expiresIn time.Duration) string {
+	t.Helper()
+	claims := jwt.MapClaims{"sub": sub}
+	if expiresIn != 0 {
+		claims["exp"] = time.Now().Add(expiresIn).Unix()
+	}
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(testSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return "Bearer " + signed
+}
+
+func dispatch(t *testing.T, h *Handler, pattern string, token string, data interface{}) models.Response {
+	t.Helper()
+	raw, err := json.Marshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h.Dispatch(context.Background(), pattern, token, raw)
+}
+
+// expectCode falla si la respuesta no tiene el código dado; "" espera éxito
+func expectCode(t *testing.T, response models.Response, code string) {
+	t.Helper()
+	if code == "" && response.Success != "success" {
+		t.Fatalf("expected success, got %s %q: %s", response.Code, response.Message, response.Data)
+	}
+	if code != "" && response.Code != code {
+		t.Fatalf("expected code %q, got %q (%s): %s", code, response.Code, response.Success, response.Data)
+	}
+}
+
+func decode(t *testing.T, response models.Response, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(response.Data, v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func decodeProduct(t *testing.T, response models.Response) models.Product {
+	t.Helper()
+	var product models.Product
+	decode(t, response, &product)
+	return product
+}
+
+// createProduct crea un producto en la categoría "ropa" y lo devuelve
+func createProduct(t *testing.T, h *Handler, token string, name string, stock int, description string) models.Product {
+	t.Helper()
+	response := dispatch(t, h, "CREATE_PRODUCT", token, map[string]interface{}{
+		"name": name, "price": 1000, "stock": stock, "description": description, "category": "ropa",
+	})
+	expectCode(t, response, "")
+	return decodeProduct(t, response)
+}
+
+func TestProductLifecycle(t *testing.T) {
+	h := newTestHandler(t)
+	mia := token(t, "mia", time.Hour)
+
+	response := dispatch(t, h, "CREATE_PRODUCT", mia, map[string]interface{}{
+		"name": "Polera", "price": 1000, "stock": 5, "description": "Algodón", "category": "ropa",
+	})
+	expectCode(t, response, "")
+	created := decodeProduct(t, response)
+	if created.Version != 1 || created.ProductID == "" {
+		t.Fatalf("unexpected product %+v", created)
+	}
+
+	response = dispatch(t, h, "CREATE_PRODUCT", mia, map[string]interface{}{
+		"name": "Polera", "price": 1000, "stock": 5, "description": "Algodón", "category": "ropa",
+	})
+	expectCode(t, response, CodeAlreadyExists)
+
+	response = dispatch(t, h, "EDIT_PRODUCT", mia, map[string]interface{}{
+		"product_id":      created.ProductID,
+		"expectedVersion": 1,
+		"patch":           map[string]interface{}{"price": 1500, "stock": 7},
+	})
+	expectCode(t, response, "")
+	if edited := decodeProduct(t, response); edited.Version != 2 || edited.Price != 1500 || edited.Stock != 7 {
+		t.Fatalf("unexpected edited product %+v", edited)
+	}
+
+	// La versión 1 ya no es la actual
+	response = dispatch(t, h, "EDIT_PRODUCT", mia, map[string]interface{}{
+		"product_id":      created.ProductID,
+		"expectedVersion": 1,
+		"patch":           map[string]interface{}{"price": 2000},
+	})
+	expectCode(t, response, CodeConflict)
+
+	response = dispatch(t, h, "GET_PRODUCT", "", created.ProductID)
+	expectCode(t, response, "")
+	if product := decodeProduct(t, response); product.Price != 1500 || product.Version != 2 {
+		t.Fatalf("conflicting edit was applied: %+v", product)
+	}
+
+	response = dispatch(t, h, "GET_STOCK_HISTORY", mia, map[string]interface{}{"product_id": created.ProductID})
+	expectCode(t, response, "")
+	var movements []models.InventoryMovement
+	decode(t, response, &movements)
+	if len(movements) != 2 || movements[0].Delta != 2 || movements[1].Source != models.MovementCreate {
+		t.Fatalf("unexpected movements %+v", movements)
+	}
+
+	response = dispatch(t, h, "DELETE_PRODUCT", mia, map[string]interface{}{"product_id": created.ProductID})
+	expectCode(t, response, "")
+
+	response = dispatch(t, h, "GET_PRODUCT", "", created.ProductID)
+	expectCode(t, response, CodeNotFound)
+
+	response = dispatch(t, h, "LIST_DELETED_PRODUCTS", mia, map[string]interface{}{})
+	expectCode(t, response, "")
+	var deleted controllers.ProductPage
+	decode(t, response, &deleted)
+	if deleted.Total != 1 || len(deleted.Items) != 1 || deleted.Items[0].ProductID != created.ProductID {
+		t.Fatalf("unexpected deleted products %+v", deleted)
+	}
+
+	response = dispatch(t, h, "RESTORE_PRODUCT", mia, map[string]interface{}{"product_id": created.ProductID})
+	expectCode(t, response, "")
+	response = dispatch(t, h, "GET_PRODUCT", "", created.ProductID)
+	expectCode(t, response, "")
+}
+
+func TestStockAdjustmentsAndReservations(t *testing.T) {
+	h := newTestHandler(t)
+	mia := token(t, "mia", time.Hour)
+	pepe := token(t, "pepe", time.Hour)
+	polera := createProduct(t, h, mia, "Polera", 5, "Algodón")
+	gorro := createProduct(t, h, mia, "Gorro", 1, "Lana")
+
+	stock := func(product models.Product) int {
+		t.Helper()
+		response := dispatch(t, h, "GET_PRODUCT", "", product.ProductID)
+		expectCode(t, response, "")
+		return decodeProduct(t, response).Stock
+	}
+
+	// Un ajuste que deja un stock negativo no aplica ninguno
+	response := dispatch(t, h, "ADJUST_STOCK_BULK", mia, map[string]interface{}{
+		"adjustments": []map[string]interface{}{
+			{"product_id": polera.ProductID, "delta": 3, "reason": "recuento"},
+			{"product_id": gorro.ProductID, "delta": -2, "reason": "recuento"},
+		},
+	})
+	expectCode(t, response, CodeOutOfStock)
+	if stock(polera) != 5 || stock(gorro) != 1 {
+		t.Fatal("rejected batch changed the stock")
+	}
+
+	// Repetir el lote con el mismo batch_id no lo aplica dos veces
+	batch := map[string]interface{}{
+		"batch_id":    "recuento-1",
+		"adjustments": []map[string]interface{}{{"product_id": polera.ProductID, "delta": 3, "reason": "recuento"}},
+	}
+	for i := 0; i < 2; i++ {
+		response = dispatch(t, h, "ADJUST_STOCK_BULK", mia, batch)
+		expectCode(t, response, "")
+		var products []models.Product
+		decode(t, response, &products)
+		if len(products) != 1 || products[0].Stock != 8 {
+			t.Fatalf("unexpected adjusted products %+v", products)
+		}
+	}
+
+	order := map[string]interface{}{
+		"orderId": "pedido-1",
+		"items": []map[string]interface{}{
+			{"product_id": polera.ProductID, "quantity": 2},
+			{"product_id": gorro.ProductID, "quantity": 1},
+		},
+	}
+	for i := 0; i < 2; i++ {
+		response = dispatch(t, h, "RESERVE_STOCK", pepe, order)
+		expectCode(t, response, "")
+	}
+	if stock(polera) != 6 || stock(gorro) != 0 {
+		t.Fatal("repeated reservation reserved the stock twice")
+	}
+
+	response = dispatch(t, h, "RESERVE_STOCK", pepe, map[string]interface{}{
+		"orderId": "pedido-2",
+		"items":   []map[string]interface{}{{"product_id": gorro.ProductID, "quantity": 1}},
+	})
+	expectCode(t, response, CodeOutOfStock)
+
+	response = dispatch(t, h, "RELEASE_RESERVATION", pepe, map[string]string{"orderId": "pedido-1"})
+	expectCode(t, response, "")
+	var reservation controllers.Reservation
+	decode(t, response, &reservation)
+	if reservation.Status != models.ReservationReleased || stock(polera) != 8 || stock(gorro) != 1 {
+		t.Fatalf("release did not return the stock: %+v", reservation)
+	}
+
+	response = dispatch(t, h, "COMMIT_RESERVATION", pepe, map[string]string{"orderId": "pedido-1"})
+	expectCode(t, response, CodeBadRequest)
+}
+
+func TestCategoriesAndSearch(t *testing.T) {
+	h := newTestHandler(t)
+	mia := token(t, "mia", time.Hour)
+
+	response := dispatch(t, h, "CREATE_CATEGORY", mia, map[string]string{"name": "Poleras", "parent": "ropa"})
+	expectCode(t, response, "")
+
+	// Una categoría no puede quedar bajo una de sus descendientes
+	response = dispatch(t, h, "EDIT_CATEGORY", mia, map[string]interface{}{"slug": "ropa", "newParent": "poleras"})
+	expectCode(t, response, CodeBadRequest)
+
+	response = dispatch(t, h, "LIST_CATEGORIES", "", map[string]bool{"tree": true})
+	expectCode(t, response, "")
+	var tree []models.Category
+	decode(t, response, &tree)
+	if len(tree) != 1 || len(tree[0].Children) != 1 || tree[0].Children[0].Slug != "poleras" {
+		t.Fatalf("unexpected category tree %+v", tree)
+	}
+
+	createProduct(t, h, mia, "Polera básica", 5, "Algodón peinado")
+	createProduct(t, h, mia, "Gorro", 1, "Lana de alpaca")
+
+	response = dispatch(t, h, "SEARCH_PRODUCTS", "", map[string]string{"query": "algod"})
+	expectCode(t, response, "")
+	var results []controllers.ProductSearchResult
+	decode(t, response, &results)
+	if len(results) != 1 || results[0].Product.Name != "Polera básica" || results[0].DescriptionHighlight != "<mark>Algodón</mark> peinado" {
+		t.Fatalf("unexpected search results %+v", results)
+	}
+
+	// Con productos la categoría no se puede borrar
+	response = dispatch(t, h, "DELETE_CATEGORY", mia, map[string]string{"slug": "ropa"})
+	expectCode(t, response, CodeBadRequest)
+	response = dispatch(t, h, "DELETE_CATEGORY", mia, map[string]string{"slug": "poleras"})
+	expectCode(t, response, "")
+}
+
+func TestAuthorization(t *testing.T) {
+	h := newTestHandler(t)
+	product := map[string]interface{}{
+		"name": "Polera", "price": 1000, "stock": 5, "description": "Algodón", "category": "ropa",
+	}
+
+	tests := []struct {
+		name    string
+		pattern string
+		token   string
+		data    interface{}
+		code    string
+	}{
+		{"missing token", "CREATE_PRODUCT", "", product, CodeUnauthorized},
+		{"expired token", "CREATE_PRODUCT", token(t, "mia", -time.Minute), product, CodeUnauthorized},
+		{"token without exp", "CREATE_PRODUCT", token(t, "mia", 0), product, CodeUnauthorized},
+		{"user without roles", "CREATE_PRODUCT", token(t, "pepe", time.Hour), product, CodeForbidden},
+		{"rename by non admin", "EDIT_USER", token(t, "pepe", time.Hour), map[string]string{"currentUsername": "mia", "newUsername": "pepe"}, CodeForbidden},
+		{"delete another user", "DELETE_USER", token(t, "pepe", time.Hour), map[string]string{"username": "mia"}, CodeForbidden},
+		{"delete self", "DELETE_USER", token(t, "pepe", time.Hour), map[string]string{"username": "pepe"}, ""},
+		{"public pattern", "FIND_ALL", "", map[string]interface{}{}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expectCode(t, dispatch(t, h, tt.pattern, tt.token, tt.data), tt.code)
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package internal
+
+import (
+	"context"
+
+	"github.com/FelipeGeraldoblufus/product-microservice-go/controllers"
+	"github.com/FelipeGeraldoblufus/product-microservice-go/models"
+)
+
+type adjustStockBulkRequest struct {
+	BatchID     string                        `json:"batch_id"`
+	Adjustments []controllers.StockAdjustment `json:"adjustments"`
+}
+
+func registerInventoryRoutes(r *Router, h *Handler) {
+	Register(r, "ADJUST_STOCK_BULK", Messages{"Stock adjusted", "Error adjusting stock"}, h.adjustStockBulk)
+	Register(r, "GET_STOCK_HISTORY", Messages{"Stock history retrieved", "Error getting stock history"}, h.getStockHistory)
+}
+
+func (h *Handler) adjustStockBulk(ctx context.Context, req adjustStockBulkRequest) ([]models.Product, error) {
+	return h.service.AdjustStockBulk(ctx, req.BatchID, req.Adjustments)
+}
+
+func (h *Handler) getStockHistory(ctx context.Context, req controllers.StockHistory) ([]models.InventoryMovement, error) {
+	if req.ProductID == "" {
+		return nil, &Error{Code: CodeBadRequest, Message: "Product id cannot be empty"}
+	}
+	return h.service.GetStockHistory(ctx, req)
+}
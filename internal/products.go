@@ -0,0 +1,182 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/FelipeGeraldoblufus/product-microservice-go/config"
+	"github.com/FelipeGeraldoblufus/product-microservice-go/controllers"
+	"github.com/FelipeGeraldoblufus/product-microservice-go/models"
+)
+
+// productUpdate es el formato anterior de EDIT_PRODUCT. Los textos vacíos y
+// newPrice 0 no modifican el campo; newStock solo se aplica si está presente.
+type productUpdate struct {
+	ProductID       string `json:"product_id"`
+	Product         string `json:"product"` // Obsoleto: nombre del producto, usar product_id
+	ExpectedVersion *int   `json:"expectedVersion"`
+	NewNameProduct  string `json:"newnameProduct"`
+	NewPrice        int64  `json:"newPrice"` // En unidades menores de la moneda
+	NewCurrency     string `json:"newCurrency"`
+	NewStock        *int   `json:"newStock"`
+	NewDescription  string `json:"newDescription"`
+	NewCategory     string `json:"newCategory"` // Slug o nombre de la categoría
+}
+
+// patch convierte el formato anterior en un ProductPatch
+func (u productUpdate) patch() controllers.ProductPatch {
+	var patch controllers.ProductPatch
+	optional := func(value string) *string {
+		if value == "" {
+			return nil
+		}
+		return &value
+	}
+	patch.Name = optional(u.NewNameProduct)
+	patch.Currency = optional(u.NewCurrency)
+	patch.Description = optional(u.NewDescription)
+	patch.Category = optional(u.NewCategory)
+	if u.NewPrice != 0 {
+		patch.Price = &u.NewPrice
+	}
+	patch.Stock = u.NewStock
+	return patch
+}
+
+// editProductRequest acepta un merge patch en patch o, por compatibilidad, el
+// formato anterior en updateDTO
+type editProductRequest struct {
+	ProductID       string                    `json:"product_id"`      // product_id o ID numérico
+	Product         string                    `json:"product"`         // Obsoleto: nombre del producto, usar product_id
+	ExpectedVersion *int                      `json:"expectedVersion"` // Opcional, falla con "conflict" si el producto ya no está en esa versión
+	Patch           *controllers.ProductPatch `json:"patch"`
+	UpdateDTO       *productUpdate            `json:"updateDTO"`
+}
+
+type createProductRequest struct {
+	Name        string `json:"name"`
+	Price       int64  `json:"price"`    // En unidades menores de la moneda
+	Currency    string `json:"currency"` // Código ISO-4217, por defecto DEFAULT_CURRENCY
+	Stock       int    `json:"stock"`
+	Description string `json:"description"`
+	Category    string `json:"category"` // Slug o nombre de la categoría
+}
+
+type deleteProductRequest struct {
+	ProductID string `json:"product_id"` // product_id o ID numérico
+	Name      string `json:"name"`       // Obsoleto: usar product_id
+}
+
+type restoreProductRequest struct {
+	ProductID string `json:"product_id"`
+}
+
+func registerProductRoutes(r *Router, h *Handler) {
+	Register(r, "GET_PRODUCT", Messages{"Product retrieved", "Error getting product"}, h.getProduct)
+	Register(r, "FIND_ALL", Messages{"Products retrieved", "Error getting products"}, h.findAllProducts)
+	Register(r, "SEARCH_PRODUCTS", Messages{"Products found", "Error searching products"}, h.searchProducts)
+	Register(r, "EDIT_PRODUCT", Messages{"Product updated", "Error updating product"}, h.editProduct)
+	Register(r, "CREATE_PRODUCT", Messages{"Product created", "Error creating product"}, h.createProduct)
+	Register(r, "DELETE_PRODUCT", Messages{"Product deleted", "Error Deleting product"}, h.deleteProduct)
+	Register(r, "LIST_DELETED_PRODUCTS", Messages{"Deleted products retrieved", "Error getting deleted products"}, h.listDeletedProducts)
+	Register(r, "RESTORE_PRODUCT", Messages{"Product restored", "Error restoring product"}, h.restoreProduct)
+}
+
+// productRef es el product_id como string o el ID numérico como número o string
+type productRef string
+
+func (r *productRef) UnmarshalJSON(data []byte) error {
+	var id uint64
+	if err := json.Unmarshal(data, &id); err == nil {
+		*r = productRef(strconv.FormatUint(id, 10))
+		return nil
+	}
+	return json.Unmarshal(data, (*string)(r))
+}
+
+// GET_PRODUCT recibe directamente el product_id o el ID numérico
+func (h *Handler) getProduct(ctx context.Context, productID productRef) (models.Product, error) {
+	return h.service.GetByProductID(ctx, string(productID))
+}
+
+func (h *Handler) findAllProducts(ctx context.Context, query controllers.ProductQuery) (controllers.ProductPage, error) {
+	return h.service.GetAllProducts(ctx, query)
+}
+
+func (h *Handler) searchProducts(ctx context.Context, search controllers.ProductSearch) ([]controllers.ProductSearchResult, error) {
+	return h.service.SearchProducts(ctx, search)
+}
+
+func (h *Handler) editProduct(ctx context.Context, req editProductRequest) (models.Product, error) {
+	if req.Patch == nil && req.UpdateDTO != nil {
+		patch := req.UpdateDTO.patch()
+		req.ProductID = req.UpdateDTO.ProductID
+		req.Product = req.UpdateDTO.Product
+		req.ExpectedVersion = req.UpdateDTO.ExpectedVersion
+		req.Patch = &patch
+	}
+	if req.ProductID == "" && req.Product == "" {
+		return models.Product{}, &Error{Code: CodeBadRequest, Message: "Product id cannot be empty"}
+	}
+	if req.Patch == nil {
+		return models.Product{}, &Error{Code: CodeBadRequest, Message: "Product patch cannot be empty"}
+	}
+
+	return h.service.UpdateProduct(ctx, productRefFor(req.ProductID, req.Product), req.ExpectedVersion, *req.Patch)
+}
+
+func (h *Handler) createProduct(ctx context.Context, req createProductRequest) (models.Product, error) {
+	return h.service.CreateProduct(ctx, req.Name, req.Price, req.Currency, req.Stock, req.Description, req.Category)
+}
+
+func (h *Handler) deleteProduct(ctx context.Context, req deleteProductRequest) (Empty, error) {
+	if req.ProductID == "" && req.Name == "" {
+		return Empty{}, &Error{Code: CodeBadRequest, Message: "Product id cannot be empty"}
+	}
+	return Empty{}, h.service.DeleteProduct(ctx, productRefFor(req.ProductID, req.Name))
+}
+
+// productRefFor arma la referencia de EDIT_PRODUCT y DELETE_PRODUCT. Avisa en el
+// log cuando un cliente todavía identifica el producto por nombre.
+func productRefFor(productID string, name string) controllers.ProductRef {
+	if productID == "" {
+		log.Printf("Deprecated: product addressed by name %q, clients should send product_id", name)
+	}
+	return controllers.ProductRef{ProductID: productID, Name: name}
+}
+
+func (h *Handler) listDeletedProducts(ctx context.Context, query controllers.DeletedProductQuery) (controllers.ProductPage, error) {
+	return h.service.ListDeletedProducts(ctx, query)
+}
+
+func (h *Handler) restoreProduct(ctx context.Context, req restoreProductRequest) (models.Product, error) {
+	if req.ProductID == "" {
+		return models.Product{}, &Error{Code: CodeBadRequest, Message: "Product id cannot be empty"}
+	}
+	return h.service.RestoreProduct(ctx, req.ProductID)
+}
+
+// PurgeDeletedProducts elimina, cada PRODUCT_PURGE_INTERVAL, los productos
+// borrados hace más de PRODUCT_RETENTION. Termina cuando ctx se cancela.
+func (h *Handler) PurgeDeletedProducts(ctx context.Context) {
+	ticker := time.NewTicker(config.ProductPurgeInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			purged, err := h.service.PurgeDeletedProducts(ctx, now.Add(-config.ProductRetention()))
+			if err != nil {
+				log.Printf("Failed to purge deleted products: %v", err)
+			}
+			if purged > 0 {
+				log.Printf("Purged %d deleted products", purged)
+			}
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Errores devueltos cuando RabbitMQ no acepta una publicación
+var (
+	ErrReturned     = errors.New("message returned as unroutable")
+	ErrNotConfirmed = errors.New("message not confirmed by broker")
+)
+
+// Cabecera usada para asociar los mensajes devueltos por RabbitMQ con su publicación
+const publishIDHeader = "x-publish-id"
+
+// Publisher publica mensajes con mandatory=true sobre un canal en modo confirm
+// y espera la confirmación del broker. Serializa el envío porque un
+// *amqp.Channel no admite publicaciones concurrentes, pero la espera de la
+// confirmación se hace fuera del lock para no frenar al resto de workers.
+type Publisher struct {
+	mu      sync.Mutex
+	tracker *confirmTracker
+
+	seq uint64
+}
+
+func NewPublisher(ch *amqp.Channel) *Publisher {
+	p := &Publisher{}
+	p.SetChannel(ch)
+	return p
+}
+
+// SetChannel reemplaza el canal, por ejemplo después de reconectar con
+// RabbitMQ. El canal debe estar en modo confirm.
+func (p *Publisher) SetChannel(ch *amqp.Channel) {
+	t := &confirmTracker{
+		ch:    ch,
+		byTag: make(map[uint64]*pendingPublish),
+		byID:  make(map[string]*pendingPublish),
+	}
+	// Sin buffer: la librería entrega cada notificación solo cuando dispatch la
+	// recibe, así que el basic.return se procesa antes que su basic.ack
+	returns := ch.NotifyReturn(make(chan amqp.Return))
+	confirms := ch.NotifyPublish(make(chan amqp.Confirmation))
+	go t.dispatch(returns, confirms)
+
+	p.mu.Lock()
+	p.tracker = t
+	p.mu.Unlock()
+}
+
+// pendingPublish es una publicación que espera su confirmación
+type pendingPublish struct {
+	id       string
+	tag      uint64
+	returned *amqp.Return
+	done     chan error
+}
+
+// confirmTracker asocia las devoluciones y confirmaciones de un canal con las
+// publicaciones que las esperan
+type confirmTracker struct {
+	ch *amqp.Channel
+
+	mu    sync.Mutex
+	byTag map[uint64]*pendingPublish // Por delivery tag, para las confirmaciones
+	byID  map[string]*pendingPublish // Por publishIDHeader, para las devoluciones
+}
+
+func (t *confirmTracker) track(pending *pendingPublish) {
+	t.mu.Lock()
+	t.byTag[pending.tag] = pending
+	t.byID[pending.id] = pending
+	t.mu.Unlock()
+}
+
+func (t *confirmTracker) untrack(pending *pendingPublish) {
+	t.mu.Lock()
+	delete(t.byTag, pending.tag)
+	delete(t.byID, pending.id)
+	t.mu.Unlock()
+}
+
+// dispatch lee las devoluciones y las confirmaciones en una sola goroutine, en
+// el orden en que llegan. RabbitMQ envía el basic.return de un mensaje antes
+// que su basic.ack, así que al resolver la confirmación ya se sabe si el
+// mensaje fue devuelto. Termina cuando se cierra el canal.
+func (t *confirmTracker) dispatch(returns <-chan amqp.Return, confirms <-chan amqp.Confirmation) {
+	for returns != nil || confirms != nil {
+		select {
+		case ret, ok := <-returns:
+			if !ok {
+				returns = nil
+				continue
+			}
+			id, _ := ret.Headers[publishIDHeader].(string)
+			t.mu.Lock()
+			if pending, ok := t.byID[id]; ok {
+				pending.returned = &ret
+			}
+			t.mu.Unlock()
+
+		case confirmation, ok := <-confirms:
+			if !ok {
+				confirms = nil
+				continue
+			}
+			t.resolve(confirmation)
+		}
+	}
+
+	// Con el canal cerrado las publicaciones pendientes ya no se confirmarán
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for tag, pending := range t.byTag {
+		pending.done <- fmt.Errorf("%w: channel closed", ErrNotConfirmed)
+		delete(t.byTag, tag)
+		delete(t.byID, pending.id)
+	}
+}
+
+// resolve entrega el resultado de la confirmación a la publicación que la espera
+func (t *confirmTracker) resolve(confirmation amqp.Confirmation) {
+	t.mu.Lock()
+	pending, ok := t.byTag[confirmation.DeliveryTag]
+	if ok {
+		delete(t.byTag, pending.tag)
+		delete(t.byID, pending.id)
+	}
+	t.mu.Unlock()
+	if !ok {
+		// La publicación dejó de esperar, por ejemplo porque venció su ctx
+		return
+	}
+
+	switch {
+	case !confirmation.Ack:
+		pending.done <- ErrNotConfirmed
+	case pending.returned != nil:
+		pending.done <- fmt.Errorf("%w: %d %s", ErrReturned, pending.returned.ReplyCode, pending.returned.ReplyText)
+	default:
+		pending.done <- nil
+	}
+}
+
+// Publish publica msg y espera a que RabbitMQ lo confirme. Devuelve
+// ErrReturned si el mensaje no se pudo enrutar a ninguna cola y
+// ErrNotConfirmed si el broker lo rechazó o no respondió antes de ctx.
+func (p *Publisher) Publish(ctx context.Context, exchange string, key string, msg amqp.Publishing) error {
+	id := strconv.FormatUint(atomic.AddUint64(&p.seq, 1), 10)
+
+	headers := amqp.Table{}
+	for k, v := range msg.Headers {
+		headers[k] = v
+	}
+	headers[publishIDHeader] = id
+	msg.Headers = headers
+
+	pending := &pendingPublish{id: id, done: make(chan error, 1)}
+
+	p.mu.Lock()
+	t := p.tracker
+	// Se registra antes de publicar para no perder una devolución o una
+	// confirmación que llegue enseguida
+	pending.tag = t.ch.GetNextPublishSeqNo()
+	t.track(pending)
+	err := t.ch.PublishWithContext(ctx,
+		exchange, // exchange
+		key,      // routing key
+		true,     // mandatory
+		false,    // immediate
+		msg)
+	p.mu.Unlock()
+	if err != nil {
+		t.untrack(pending)
+		return err
+	}
+
+	select {
+	case err := <-pending.done:
+		return err
+	case <-ctx.Done():
+		t.untrack(pending)
+		return fmt.Errorf("%w: %v", ErrNotConfirmed, ctx.Err())
+	}
+}
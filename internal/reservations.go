@@ -0,0 +1,64 @@
+package internal
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/FelipeGeraldoblufus/product-microservice-go/config"
+	"github.com/FelipeGeraldoblufus/product-microservice-go/controllers"
+)
+
+type reserveStockRequest struct {
+	OrderID    string                        `json:"orderId"`
+	Items      []controllers.ReservationItem `json:"items"`
+	TTLSeconds int                           `json:"ttlSeconds"` // Opcional, por defecto RESERVATION_TTL
+}
+
+type orderRequest struct {
+	OrderID string `json:"orderId"`
+}
+
+func registerReservationRoutes(r *Router, h *Handler) {
+	Register(r, "RESERVE_STOCK", Messages{"Stock reserved", "Error reserving stock"}, h.reserveStock)
+	Register(r, "COMMIT_RESERVATION", Messages{"Reservation committed", "Error committing reservation"}, h.commitReservation)
+	Register(r, "RELEASE_RESERVATION", Messages{"Reservation released", "Error releasing reservation"}, h.releaseReservation)
+}
+
+func (h *Handler) reserveStock(ctx context.Context, req reserveStockRequest) (controllers.Reservation, error) {
+	ttl := config.ReservationTTL()
+	if req.TTLSeconds > 0 {
+		ttl = time.Duration(req.TTLSeconds) * time.Second
+	}
+	return h.service.ReserveStock(ctx, req.OrderID, req.Items, ttl)
+}
+
+func (h *Handler) commitReservation(ctx context.Context, req orderRequest) (controllers.Reservation, error) {
+	return h.service.CommitReservation(ctx, req.OrderID)
+}
+
+func (h *Handler) releaseReservation(ctx context.Context, req orderRequest) (controllers.Reservation, error) {
+	return h.service.ReleaseReservation(ctx, req.OrderID)
+}
+
+// ExpireReservations devuelve al stock, cada RESERVATION_SWEEP_INTERVAL, las
+// reservas que vencieron sin confirmarse. Termina cuando ctx se cancela.
+func (h *Handler) ExpireReservations(ctx context.Context) {
+	ticker := time.NewTicker(config.ReservationSweepInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			expired, err := h.service.ExpireReservations(ctx, now)
+			if err != nil {
+				log.Printf("Failed to expire reservations: %v", err)
+			}
+			if expired > 0 {
+				log.Printf("Expired %d stock reservations", expired)
+			}
+		}
+	}
+}
@@ -0,0 +1,422 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/FelipeGeraldoblufus/product-microservice-go/config"
+	"github.com/FelipeGeraldoblufus/product-microservice-go/controllers"
+	"github.com/gorilla/mux"
+)
+
+// httpError es el cuerpo de las respuestas de error de la API REST
+type httpError struct {
+	Code    string            `json:"code"`
+	Message string            `json:"message"`
+	Error   string            `json:"error"`
+	Fields  map[string]string `json:"fields,omitempty"` // Problemas por campo de un ValidationError
+}
+
+// NewHTTPHandler crea la API REST. Cada endpoint usa los mismos handlers que
+// el patrón RPC equivalente en h.
+func NewHTTPHandler(h *Handler) http.Handler {
+	r := mux.NewRouter()
+
+	r.HandleFunc("/health", health).Methods(http.MethodGet)
+
+	r.HandleFunc("/products", h.listProductsHTTP).Methods(http.MethodGet)
+	r.HandleFunc("/products", h.withAuth("CREATE_PRODUCT", h.createProductHTTP)).Methods(http.MethodPost)
+	r.HandleFunc("/products/search", h.searchProductsHTTP).Methods(http.MethodGet)
+	r.HandleFunc("/products/deleted", h.withAuth("LIST_DELETED_PRODUCTS", h.listDeletedProductsHTTP)).Methods(http.MethodGet)
+	r.HandleFunc("/products/{product_id}/restore", h.withAuth("RESTORE_PRODUCT", h.restoreProductHTTP)).Methods(http.MethodPost)
+	r.HandleFunc("/products/{product_id}", h.getProductHTTP).Methods(http.MethodGet)
+	r.HandleFunc("/products/{product_id}", h.withAuth("EDIT_PRODUCT", h.editProductHTTP)).Methods(http.MethodPatch)
+	r.HandleFunc("/products/{product_id}", h.withAuth("DELETE_PRODUCT", h.deleteProductHTTP)).Methods(http.MethodDelete)
+
+	r.HandleFunc("/categories", h.listCategoriesHTTP).Methods(http.MethodGet)
+	r.HandleFunc("/categories", h.withAuth("CREATE_CATEGORY", h.createCategoryHTTP)).Methods(http.MethodPost)
+	r.HandleFunc("/categories/{slug}", h.withAuth("EDIT_CATEGORY", h.editCategoryHTTP)).Methods(http.MethodPatch)
+	r.HandleFunc("/categories/{slug}", h.withAuth("DELETE_CATEGORY", h.deleteCategoryHTTP)).Methods(http.MethodDelete)
+
+	r.HandleFunc("/inventory/adjustments", h.withAuth("ADJUST_STOCK_BULK", h.adjustStockBulkHTTP)).Methods(http.MethodPost)
+	r.HandleFunc("/inventory/{product_id}/movements", h.withAuth("GET_STOCK_HISTORY", h.stockHistoryHTTP)).Methods(http.MethodGet)
+
+	r.HandleFunc("/reservations", h.withAuth("RESERVE_STOCK", h.reserveStockHTTP)).Methods(http.MethodPost)
+	r.HandleFunc("/reservations/{order_id}/commit", h.withAuth("COMMIT_RESERVATION", h.commitReservationHTTP)).Methods(http.MethodPost)
+	r.HandleFunc("/reservations/{order_id}/release", h.withAuth("RELEASE_RESERVATION", h.releaseReservationHTTP)).Methods(http.MethodPost)
+
+	r.HandleFunc("/users", h.withAuth("LIST_USERS", h.listUsersHTTP)).Methods(http.MethodGet)
+	r.HandleFunc("/users", h.withAuth("CREATE_USER", h.createUserHTTP)).Methods(http.MethodPost)
+	r.HandleFunc("/users/{username}", h.getUserHTTP).Methods(http.MethodGet)
+	r.HandleFunc("/users/{username}", h.withAuth("EDIT_USER", h.editUserHTTP)).Methods(http.MethodPatch)
+	r.HandleFunc("/users/{username}", h.withAuth("DELETE_USER", h.deleteUserHTTP)).Methods(http.MethodDelete)
+	r.HandleFunc("/users/{username}/roles", h.withAuth("SET_USER_ROLES", h.setUserRolesHTTP)).Methods(http.MethodPut)
+
+	r.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusNotFound, httpError{Code: CodeNotFound, Message: "Route not found", Error: r.URL.Path})
+	})
+	r.MethodNotAllowedHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusMethodNotAllowed, httpError{Code: CodeBadRequest, Message: "Method not allowed", Error: r.Method})
+	})
+
+	return r
+}
+
+// withAuth aplica a un endpoint la misma autenticación que al patrón RPC equivalente
+func (h *Handler) withAuth(pattern string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, err := h.authenticate(r.Context(), pattern, r.Header.Get("Authorization"))
+		if err != nil {
+			respond(w, http.StatusOK, nil, err, "Unauthorized")
+			return
+		}
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// databaseHealth es el estado de Postgres y de su pool de conexiones en /health
+type databaseHealth struct {
+	Status             string `json:"status"`
+	Error              string `json:"error,omitempty"`
+	MaxOpenConnections int    `json:"maxOpenConnections"`
+	OpenConnections    int    `json:"openConnections"`
+	InUse              int    `json:"inUse"`
+	Idle               int    `json:"idle"`
+	WaitCount          int64  `json:"waitCount"`
+	WaitDuration       string `json:"waitDuration"`
+	MaxIdleClosed      int64  `json:"maxIdleClosed"`
+	MaxIdleTimeClosed  int64  `json:"maxIdleTimeClosed"`
+	MaxLifetimeClosed  int64  `json:"maxLifetimeClosed"`
+}
+
+func health(w http.ResponseWriter, r *http.Request) {
+	status := http.StatusOK
+	state := config.RabbitMQState()
+	if state != config.StateConnected {
+		status = http.StatusServiceUnavailable
+	}
+
+	database := databaseHealth{Status: "up"}
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+	if err := config.PingDatabase(ctx); err != nil {
+		status = http.StatusServiceUnavailable
+		database.Status = "down"
+		database.Error = err.Error()
+	}
+	if stats, err := config.DatabaseStats(); err == nil {
+		database.MaxOpenConnections = stats.MaxOpenConnections
+		database.OpenConnections = stats.OpenConnections
+		database.InUse = stats.InUse
+		database.Idle = stats.Idle
+		database.WaitCount = stats.WaitCount
+		database.WaitDuration = stats.WaitDuration.String()
+		database.MaxIdleClosed = stats.MaxIdleClosed
+		database.MaxIdleTimeClosed = stats.MaxIdleTimeClosed
+		database.MaxLifetimeClosed = stats.MaxLifetimeClosed
+	}
+
+	writeJSON(w, status, map[string]interface{}{"rabbitmq": state, "database": database})
+}
+
+func (h *Handler) listProductsHTTP(w http.ResponseWriter, r *http.Request) {
+	query, err := productQueryFromURL(r.URL.Query())
+	if err != nil {
+		respond(w, http.StatusOK, nil, err, "Error getting products")
+		return
+	}
+	products, err := h.findAllProducts(r.Context(), query)
+	respond(w, http.StatusOK, products, err, "Error getting products")
+}
+
+// productQueryFromURL lee los parámetros de FIND_ALL de la query string
+func productQueryFromURL(values url.Values) (controllers.ProductQuery, error) {
+	query := controllers.ProductQuery{
+		Cursor:   values.Get("cursor"),
+		Category: values.Get("category"),
+		Sort:     values.Get("sort"),
+	}
+
+	var err error
+	parseInt := func(name string) *int {
+		if err != nil || values.Get(name) == "" {
+			return nil
+		}
+		n, convErr := strconv.Atoi(values.Get(name))
+		if convErr != nil {
+			err = &Error{Code: CodeBadRequest, Message: "Invalid query parameter " + name, Err: convErr}
+			return nil
+		}
+		return &n
+	}
+
+	if page := parseInt("page"); page != nil {
+		query.Page = *page
+	}
+	if pageSize := parseInt("pageSize"); pageSize != nil {
+		query.PageSize = *pageSize
+	}
+	if minPrice := parseInt("minPrice"); minPrice != nil {
+		query.MinPrice = new(int64)
+		*query.MinPrice = int64(*minPrice)
+	}
+	if maxPrice := parseInt("maxPrice"); maxPrice != nil {
+		query.MaxPrice = new(int64)
+		*query.MaxPrice = int64(*maxPrice)
+	}
+	if err == nil && values.Get("inStock") != "" {
+		inStock, convErr := strconv.ParseBool(values.Get("inStock"))
+		if convErr != nil {
+			err = &Error{Code: CodeBadRequest, Message: "Invalid query parameter inStock", Err: convErr}
+		}
+		query.InStock = &inStock
+	}
+
+	return query, err
+}
+
+func (h *Handler) searchProductsHTTP(w http.ResponseWriter, r *http.Request) {
+	values := r.URL.Query()
+	search := controllers.ProductSearch{
+		Query:    values.Get("q"),
+		Language: values.Get("language"),
+	}
+	if values.Get("prefix") != "" {
+		prefix := values.Get("prefix") != "false"
+		search.Prefix = &prefix
+	}
+	search.Limit, _ = strconv.Atoi(values.Get("limit"))
+	search.Offset, _ = strconv.Atoi(values.Get("offset"))
+
+	results, err := h.searchProducts(r.Context(), search)
+	respond(w, http.StatusOK, results, err, "Error searching products")
+}
+
+func (h *Handler) getProductHTTP(w http.ResponseWriter, r *http.Request) {
+	product, err := h.getProduct(r.Context(), productRef(mux.Vars(r)["product_id"]))
+	respond(w, http.StatusOK, product, err, "Error getting product")
+}
+
+func (h *Handler) createProductHTTP(w http.ResponseWriter, r *http.Request) {
+	var req createProductRequest
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	product, err := h.createProduct(r.Context(), req)
+	respond(w, http.StatusCreated, product, err, "Error creating product")
+}
+
+// editProductHTTP recibe el merge patch como cuerpo y la versión esperada, si
+// la hay, en el header If-Match
+func (h *Handler) editProductHTTP(w http.ResponseWriter, r *http.Request) {
+	req := editProductRequest{ProductID: mux.Vars(r)["product_id"], Patch: &controllers.ProductPatch{}}
+	if !decodeBody(w, r, req.Patch) {
+		return
+	}
+	if ifMatch := strings.Trim(r.Header.Get("If-Match"), `"`); ifMatch != "" {
+		version, err := strconv.Atoi(ifMatch)
+		if err != nil {
+			respond(w, http.StatusOK, nil, &Error{Code: CodeBadRequest, Message: "Invalid If-Match header", Err: err}, "Error updating product")
+			return
+		}
+		req.ExpectedVersion = &version
+	}
+	product, err := h.editProduct(r.Context(), req)
+	respond(w, http.StatusOK, product, err, "Error updating product")
+}
+
+func (h *Handler) deleteProductHTTP(w http.ResponseWriter, r *http.Request) {
+	_, err := h.deleteProduct(r.Context(), deleteProductRequest{ProductID: mux.Vars(r)["product_id"]})
+	respond(w, http.StatusNoContent, nil, err, "Error deleting product")
+}
+
+func (h *Handler) listDeletedProductsHTTP(w http.ResponseWriter, r *http.Request) {
+	var query controllers.DeletedProductQuery
+	query.Page, _ = strconv.Atoi(r.URL.Query().Get("page"))
+	query.PageSize, _ = strconv.Atoi(r.URL.Query().Get("pageSize"))
+	products, err := h.listDeletedProducts(r.Context(), query)
+	respond(w, http.StatusOK, products, err, "Error getting deleted products")
+}
+
+func (h *Handler) restoreProductHTTP(w http.ResponseWriter, r *http.Request) {
+	product, err := h.restoreProduct(r.Context(), restoreProductRequest{ProductID: mux.Vars(r)["product_id"]})
+	respond(w, http.StatusOK, product, err, "Error restoring product")
+}
+
+func (h *Handler) listCategoriesHTTP(w http.ResponseWriter, r *http.Request) {
+	tree, _ := strconv.ParseBool(r.URL.Query().Get("tree"))
+	categories, err := h.listCategories(r.Context(), listCategoriesRequest{Tree: tree})
+	respond(w, http.StatusOK, categories, err, "Error getting categories")
+}
+
+func (h *Handler) createCategoryHTTP(w http.ResponseWriter, r *http.Request) {
+	var req createCategoryRequest
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	category, err := h.createCategory(r.Context(), req)
+	respond(w, http.StatusCreated, category, err, "Error creating category")
+}
+
+func (h *Handler) editCategoryHTTP(w http.ResponseWriter, r *http.Request) {
+	var req editCategoryRequest
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	req.Slug = mux.Vars(r)["slug"]
+	category, err := h.editCategory(r.Context(), req)
+	respond(w, http.StatusOK, category, err, "Error updating category")
+}
+
+func (h *Handler) deleteCategoryHTTP(w http.ResponseWriter, r *http.Request) {
+	_, err := h.deleteCategory(r.Context(), deleteCategoryRequest{Slug: mux.Vars(r)["slug"]})
+	respond(w, http.StatusNoContent, nil, err, "Error deleting category")
+}
+
+func (h *Handler) adjustStockBulkHTTP(w http.ResponseWriter, r *http.Request) {
+	var req adjustStockBulkRequest
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	products, err := h.adjustStockBulk(r.Context(), req)
+	respond(w, http.StatusOK, products, err, "Error adjusting stock")
+}
+
+func (h *Handler) stockHistoryHTTP(w http.ResponseWriter, r *http.Request) {
+	query := controllers.StockHistory{ProductID: mux.Vars(r)["product_id"]}
+	query.Limit, _ = strconv.Atoi(r.URL.Query().Get("limit"))
+	query.Offset, _ = strconv.Atoi(r.URL.Query().Get("offset"))
+	movements, err := h.getStockHistory(r.Context(), query)
+	respond(w, http.StatusOK, movements, err, "Error getting stock history")
+}
+
+func (h *Handler) reserveStockHTTP(w http.ResponseWriter, r *http.Request) {
+	var req reserveStockRequest
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	reservation, err := h.reserveStock(r.Context(), req)
+	respond(w, http.StatusOK, reservation, err, "Error reserving stock")
+}
+
+func (h *Handler) commitReservationHTTP(w http.ResponseWriter, r *http.Request) {
+	reservation, err := h.commitReservation(r.Context(), orderRequest{OrderID: mux.Vars(r)["order_id"]})
+	respond(w, http.StatusOK, reservation, err, "Error committing reservation")
+}
+
+func (h *Handler) releaseReservationHTTP(w http.ResponseWriter, r *http.Request) {
+	reservation, err := h.releaseReservation(r.Context(), orderRequest{OrderID: mux.Vars(r)["order_id"]})
+	respond(w, http.StatusOK, reservation, err, "Error releasing reservation")
+}
+
+func (h *Handler) listUsersHTTP(w http.ResponseWriter, r *http.Request) {
+	users, err := h.service.GetUser(r.Context(), "")
+	respond(w, http.StatusOK, users, err, "Error getting users")
+}
+
+func (h *Handler) getUserHTTP(w http.ResponseWriter, r *http.Request) {
+	// A diferencia de GET_USERBYNAME, un usuario inexistente es un 404
+	user, err := h.service.FindUser(r.Context(), mux.Vars(r)["username"])
+	respond(w, http.StatusOK, user, err, "Error getting user")
+}
+
+func (h *Handler) createUserHTTP(w http.ResponseWriter, r *http.Request) {
+	var req usernameRequest
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	user, err := h.createUser(r.Context(), req)
+	respond(w, http.StatusCreated, user, err, "Error creating user")
+}
+
+func (h *Handler) editUserHTTP(w http.ResponseWriter, r *http.Request) {
+	var req editUserRequest
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	req.CurrentUsername = mux.Vars(r)["username"]
+	_, err := h.editUser(r.Context(), req)
+	respond(w, http.StatusNoContent, nil, err, "Error editing user")
+}
+
+func (h *Handler) deleteUserHTTP(w http.ResponseWriter, r *http.Request) {
+	_, err := h.deleteUser(r.Context(), usernameRequest{Username: mux.Vars(r)["username"]})
+	respond(w, http.StatusNoContent, nil, err, "Error deleting user")
+}
+
+func (h *Handler) setUserRolesHTTP(w http.ResponseWriter, r *http.Request) {
+	var req setUserRolesRequest
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	req.Username = mux.Vars(r)["username"]
+	user, err := h.setUserRoles(r.Context(), req)
+	respond(w, http.StatusOK, user, err, "Error updating user roles")
+}
+
+// decodeBody decodifica el cuerpo JSON en v. Si falla responde 400 y devuelve false.
+func decodeBody(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeJSON(w, http.StatusBadRequest, httpError{Code: CodeBadRequest, Message: "Error decoding JSON", Error: err.Error()})
+		return false
+	}
+	return true
+}
+
+// respond escribe data con el status indicado, o el error con el status que
+// corresponde a su código.
+func respond(w http.ResponseWriter, status int, data interface{}, err error, failure string) {
+	if err != nil {
+		log.Printf("HTTP error: %v", err)
+		code, message := describeError(err, failure)
+		body := httpError{Code: code, Message: message, Error: err.Error()}
+		var validationErr *controllers.ValidationError
+		if errors.As(err, &validationErr) {
+			body.Fields = validationErr.Fields
+		}
+		writeJSON(w, httpStatus(code), body)
+		return
+	}
+	if status == http.StatusNoContent {
+		w.WriteHeader(status)
+		return
+	}
+	writeJSON(w, status, data)
+}
+
+// httpStatus traduce un código de error al status HTTP equivalente
+func httpStatus(code string) int {
+	switch code {
+	case CodeBadRequest:
+		return http.StatusBadRequest
+	case CodeNotFound, CodeUnknownPattern:
+		return http.StatusNotFound
+	case CodeAlreadyExists, CodeOutOfStock, CodeConflict:
+		return http.StatusConflict
+	case CodeUnauthorized:
+		return http.StatusUnauthorized
+	case CodeForbidden:
+		return http.StatusForbidden
+	case CodeTimeout:
+		return http.StatusGatewayTimeout
+	case CodeUnavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Error writing HTTP response: %v", err)
+	}
+}
@@ -0,0 +1,109 @@
+package internal
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/FelipeGeraldoblufus/product-microservice-go/config"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Cabecera con el número de veces que un mensaje se ha reintentado
+const retryHeader = "x-retry-count"
+
+// Cabecera con la expiración AMQP que puso el cliente. En la cola de
+// reintentos la expiración es la espera, y RabbitMQ la quita al devolver el
+// mensaje a la cola principal.
+const expirationHeader = "x-original-expiration"
+
+// retryCount lee el contador de reintentos de las cabeceras del mensaje
+func retryCount(d amqp.Delivery) int {
+	switch v := d.Headers[retryHeader].(type) {
+	case int:
+		return v
+	case int32:
+		return int(v)
+	case int64:
+		return int(v)
+	default:
+		return 0
+	}
+}
+
+// lastAttempt indica si el mensaje ya no se reintentará si vuelve a fallar
+func lastAttempt(d amqp.Delivery) bool {
+	return retryCount(d)+1 >= config.MaxDeliveryAttempts()
+}
+
+// retryDelay devuelve la espera antes de reintentar un mensaje que ya falló
+// attempts veces: RETRY_BACKOFF duplicado en cada intento, hasta RETRY_MAX_BACKOFF
+func retryDelay(attempts int) time.Duration {
+	delay, limit := config.RetryBackoff(), config.RetryMaxBackoff()
+	for i := 1; i < attempts && delay < limit; i++ {
+		delay *= 2
+	}
+	return min(delay, limit)
+}
+
+// retryOrDeadLetter publica el mensaje en la cola de reintentos con el contador
+// incrementado y confirma el original. La espera va como expiración del
+// mensaje: al vencer, RabbitMQ lo devuelve a la cola principal. Como solo
+// vence el primero de la cola, un mensaje puede esperar además a los que
+// tiene delante, como mucho RETRY_MAX_BACKOFF. Cuando se alcanza
+// MAX_DELIVERY_ATTEMPTS el mensaje se rechaza sin reencolar y RabbitMQ lo
+// envía a la DLQ.
+func retryOrDeadLetter(pub *Publisher, d amqp.Delivery, cause error) {
+	attempts := retryCount(d) + 1
+	if lastAttempt(d) {
+		log.Printf("Message failed %d times, sending to dead letter queue: %v", attempts, cause)
+		if err := d.Nack(false, false); err != nil {
+			log.Printf("Failed to reject message: %v", err)
+		}
+		return
+	}
+
+	headers := amqp.Table{}
+	for k, v := range d.Headers {
+		headers[k] = v
+	}
+	headers[retryHeader] = int32(attempts)
+	if d.Expiration != "" {
+		headers[expirationHeader] = d.Expiration
+	}
+	// Sin hora de publicación, la expiración del cliente se cuenta desde el primer reintento
+	timestamp := d.Timestamp
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+
+	delay := retryDelay(attempts)
+	log.Printf("Retrying message in %s (attempt %d): %v", delay, attempts+1, cause)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := pub.Publish(ctx, "", config.RetryQueue(), amqp.Publishing{
+		Headers:       headers,
+		ContentType:   d.ContentType,
+		CorrelationId: d.CorrelationId,
+		ReplyTo:       d.ReplyTo,
+		MessageId:     d.MessageId,
+		Timestamp:     timestamp,
+		Expiration:    strconv.FormatInt(delay.Milliseconds(), 10),
+		DeliveryMode:  d.DeliveryMode,
+		Body:          d.Body,
+	})
+	if err != nil {
+		// No se pudo republicar: se deja que RabbitMQ lo vuelva a entregar
+		log.Printf("Failed to republish message: %v", err)
+		if err := d.Nack(false, true); err != nil {
+			log.Printf("Failed to requeue message: %v", err)
+		}
+		return
+	}
+
+	if err := d.Ack(false); err != nil {
+		log.Printf("Failed to ack message: %v", err)
+	}
+}
@@ -0,0 +1,295 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"runtime/debug"
+	"strings"
+
+	"github.com/FelipeGeraldoblufus/product-microservice-go/auth"
+	"github.com/FelipeGeraldoblufus/product-microservice-go/controllers"
+	"github.com/FelipeGeraldoblufus/product-microservice-go/models"
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+)
+
+// Códigos de error devueltos en models.Response.Code
+const (
+	CodeUnknownPattern = "unknown_pattern"
+	CodeBadRequest     = "bad_request"
+	CodeNotFound       = "not_found"
+	CodeAlreadyExists  = "already_exists"
+	CodeOutOfStock     = "insufficient_stock"
+	CodeConflict       = "conflict"
+	CodeTimeout        = "timeout"
+	CodeUnavailable    = "unavailable" // Fallo transitorio de la base de datos
+	CodeUnauthorized   = "unauthorized"
+	CodeForbidden      = "forbidden"
+	CodeFailed         = "failed"
+	CodeInternal       = "internal"
+)
+
+// Error permite a un handler elegir el código y el mensaje de la respuesta de error.
+type Error struct {
+	Code    string
+	Message string
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Messages son los textos usados en la respuesta de un patrón según su resultado.
+type Messages struct {
+	Success string
+	Failure string
+}
+
+// Empty se usa como tipo de respuesta cuando un patrón no devuelve datos.
+type Empty struct{}
+
+// route ejecuta un patrón. Si falla devuelve también el error que lo causó.
+type route func(ctx context.Context, data json.RawMessage) (models.Response, error)
+
+// Router asocia cada patrón RPC con su handler.
+type Router struct {
+	routes map[string]route
+}
+
+func NewRouter() *Router {
+	return &Router{routes: make(map[string]route)}
+}
+
+// Register registra fn para el patrón dado. Los datos del mensaje se decodifican
+// en Req y el valor Res devuelto se serializa como Data de la respuesta.
+func Register[Req, Res any](r *Router, pattern string, msgs Messages, fn func(ctx context.Context, req Req) (Res, error)) {
+	if _, exists := r.routes[pattern]; exists {
+		panic(fmt.Sprintf("pattern %s already registered", pattern))
+	}
+
+	r.routes[pattern] = func(ctx context.Context, data json.RawMessage) (models.Response, error) {
+		var req Req
+		if len(data) > 0 {
+			if err := json.Unmarshal(data, &req); err != nil {
+				log.Printf("Error unmarshalling data for %s: %v", pattern, err)
+				return errorResponse(CodeBadRequest, "Error decoding JSON", err), err
+			}
+		}
+
+		res, err := fn(ctx, req)
+		if err != nil {
+			log.Printf("Error handling %s: %v", pattern, err)
+			code, message := describeError(err, msgs.Failure)
+			return errorResponse(code, message, err), err
+		}
+
+		if _, ok := any(res).(Empty); ok {
+			return models.Response{Success: "success", Message: msgs.Success}, nil
+		}
+
+		resJSON, err := json.Marshal(res)
+		if err != nil {
+			log.Printf("Error marshaling response for %s: %v", pattern, err)
+			return errorResponse(CodeInternal, "Error marshaling JSON", err), err
+		}
+
+		return models.Response{
+			Success: "success",
+			Message: msgs.Success,
+			Data:    resJSON,
+		}, nil
+	}
+}
+
+// Dispatch ejecuta el handler registrado para el patrón. Si el patrón no existe
+// devuelve una respuesta de error con el código CodeUnknownPattern y si el
+// handler entra en pánico, una con CodeInternal. Si falla devuelve también el
+// error que lo causó.
+func (r *Router) Dispatch(ctx context.Context, pattern string, data json.RawMessage) (response models.Response, err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			log.Printf("Recovered from panic handling %s: %v\n%s", pattern, rec, debug.Stack())
+			err = fmt.Errorf("panic: %v", rec)
+			response = errorResponse(CodeInternal, "Internal error", err)
+		}
+	}()
+
+	handle, ok := r.routes[pattern]
+	if !ok {
+		log.Printf("Unknown pattern: %q", pattern)
+		err = fmt.Errorf("unknown pattern %q", pattern)
+		return errorResponse(CodeUnknownPattern, "Unknown pattern", err), err
+	}
+
+	// Queda registrado quién hizo cada petición autenticada
+	if claims, ok := auth.FromContext(ctx); ok && claims.Subject != "" {
+		log.Printf(" [.] Handling %s for %q", pattern, claims.Subject)
+	} else {
+		log.Printf(" [.] Handling %s", pattern)
+	}
+	return handle(ctx, data)
+}
+
+// describeError devuelve el código y el mensaje para un error de un handler.
+// Un *Error define ambos; los errores de los controladores se traducen según
+// el error base que envuelven.
+func describeError(err error, failure string) (code string, message string) {
+	var handlerErr *Error
+	if errors.As(err, &handlerErr) {
+		message = handlerErr.Message
+		if message == "" {
+			message = failure
+		}
+		return handlerErr.Code, message
+	}
+
+	switch {
+	case isTimeout(err):
+		return CodeTimeout, timeoutMessage
+	case isTransient(err):
+		return CodeUnavailable, failure
+	case errors.Is(err, controllers.ErrNotFound), errors.Is(err, gorm.ErrRecordNotFound):
+		return CodeNotFound, failure
+	case errors.Is(err, controllers.ErrAlreadyExists):
+		return CodeAlreadyExists, failure
+	case errors.Is(err, controllers.ErrConflict):
+		return CodeConflict, failure
+	case errors.Is(err, controllers.ErrInsufficientStock):
+		return CodeOutOfStock, failure
+	case errors.Is(err, controllers.ErrInvalid):
+		return CodeBadRequest, failure
+	default:
+		return CodeFailed, failure
+	}
+}
+
+// Mensaje de las respuestas con CodeTimeout
+const timeoutMessage = "Request deadline exceeded"
+
+// SQLSTATE query_canceled de Postgres
+const pgQueryCanceled = "57014"
+
+// isTimeout indica si err se debe a que venció el plazo de la petición o a
+// que Postgres canceló la consulta (statement_timeout o cancelación)
+func isTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == pgQueryCanceled
+}
+
+// isTransient indica si err es un fallo de conexión con Postgres o un
+// conflicto entre transacciones, que pueden no repetirse al reintentar. No
+// indica si algo se llegó a escribir: un error de red durante el COMMIT es
+// transitorio aunque el servidor haya confirmado la transacción.
+func isTransient(err error) bool {
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) {
+		return true
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case "40001", "40P01", "53300", "57P01", "57P02", "57P03":
+			// serialization_failure, deadlock_detected, too_many_connections y
+			// el servidor apagándose o arrancando
+			return true
+		}
+		return strings.HasPrefix(pgErr.Code, "08") // connection_exception
+	}
+
+	var safe interface{ SafeToRetry() bool }
+	if errors.As(err, &safe) && safe.SafeToRetry() {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// beforeWrite indica si err ocurrió sin llegar a enviar nada a Postgres, al
+// conectar o al obtener una conexión. Los handlers escriben como mucho en una
+// transacción, la última operación con la base de datos, así que ese error
+// garantiza que la petición no cambió nada.
+func beforeWrite(err error) bool {
+	// database/sql solo devuelve ErrBadConn si el servidor no pudo ejecutar nada
+	if errors.Is(err, driver.ErrBadConn) {
+		return true
+	}
+	var safe interface{ SafeToRetry() bool }
+	if errors.As(err, &safe) && safe.SafeToRetry() {
+		return true
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case "53300", "57P03", "08001", "08004":
+			// too_many_connections, cannot_connect_now y conexión rechazada
+			return true
+		}
+		return false
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// Patrones que se pueden volver a ejecutar sin aplicar dos veces un cambio: los
+// de solo lectura y los que, repetidos, dejan el mismo resultado
+var idempotent = map[string]bool{
+	"GET_PRODUCT":           true,
+	"FIND_ALL":              true,
+	"SEARCH_PRODUCTS":       true,
+	"LIST_DELETED_PRODUCTS": true,
+	"LIST_CATEGORIES":       true,
+	"GET_STOCK_HISTORY":     true,
+	"GET_USERBYNAME":        true,
+	"SET_USER_ROLES":        true, // Reemplaza los roles, no los agrega
+	"RESERVE_STOCK":         true, // Repetir con el mismo order_id devuelve la reserva existente
+	"COMMIT_RESERVATION":    true,
+	"RELEASE_RESERVATION":   true,
+}
+
+// replayable indica si, en vez de responder, conviene volver a ejecutar la
+// petición más tarde. Solo se repiten los pánicos y los fallos transitorios,
+// y solo si repetir no puede aplicar un cambio dos veces: porque el patrón es
+// idempotente o porque el error ocurrió antes de escribir nada.
+func replayable(pattern string, response models.Response, err error) bool {
+	if response.Code != CodeInternal && response.Code != CodeUnavailable {
+		return false
+	}
+	return idempotent[pattern] || beforeWrite(err)
+}
+
+// errorResponse arma una respuesta de error con el texto del error como Data.
+// Un ValidationError se envía como JSON para que el cliente vea cada campo.
+func errorResponse(code string, message string, err error) models.Response {
+	data := []byte(err.Error())
+	var validationErr *controllers.ValidationError
+	if errors.As(err, &validationErr) {
+		if fieldsJSON, jsonErr := json.Marshal(validationErr); jsonErr == nil {
+			data = fieldsJSON
+		}
+	}
+
+	return models.Response{
+		Success: "error",
+		Code:    code,
+		Message: message,
+		Data:    data,
+	}
+}
@@ -0,0 +1,54 @@
+package internal
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/FelipeGeraldoblufus/product-microservice-go/models"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestReplayable(t *testing.T) {
+	unavailable := models.Response{Code: CodeUnavailable}
+	commitErr := fmt.Errorf("commit: %w", &net.OpError{Op: "read", Err: errors.New("connection reset by peer")})
+	dialErr := fmt.Errorf("connect: %w", &net.OpError{Op: "dial", Err: errors.New("connection refused")})
+
+	tests := []struct {
+		name     string
+		pattern  string
+		response models.Response
+		err      error
+		want     bool
+	}{
+		{"read after network error", "GET_PRODUCT", unavailable, commitErr, true},
+		{"write after network error", "CREATE_PRODUCT", unavailable, commitErr, false},
+		{"write after deadlock", "ADJUST_STOCK_BULK", unavailable, &pgconn.PgError{Code: "40P01"}, false},
+		{"write before connecting", "CREATE_PRODUCT", unavailable, dialErr, true},
+		{"write with bad connection", "EDIT_PRODUCT", unavailable, driver.ErrBadConn, true},
+		{"write with too many connections", "DELETE_PRODUCT", unavailable, &pgconn.PgError{Code: "53300"}, true},
+		{"panic in write", "CREATE_PRODUCT", models.Response{Code: CodeInternal}, errors.New("panic: boom"), false},
+		{"panic in idempotent write", "RESERVE_STOCK", models.Response{Code: CodeInternal}, errors.New("panic: boom"), true},
+		{"not transient", "GET_PRODUCT", models.Response{Code: CodeNotFound}, errors.New("not found"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := replayable(tt.pattern, tt.response, tt.err); got != tt.want {
+				t.Fatalf("replayable(%s, %s, %v) = %v, want %v", tt.pattern, tt.response.Code, tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	t.Setenv("RETRY_BACKOFF", "1s")
+	t.Setenv("RETRY_MAX_BACKOFF", "5s")
+
+	for attempts, want := range map[int]string{1: "1s", 2: "2s", 3: "4s", 4: "5s", 10: "5s"} {
+		if got := retryDelay(attempts).String(); got != want {
+			t.Errorf("retryDelay(%d) = %s, want %s", attempts, got, want)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/FelipeGeraldoblufus/product-microservice-go/models"
+)
+
+type getUserByNameRequest struct {
+	Name string `json:"username"`
+}
+
+type editUserRequest struct {
+	CurrentUsername string `json:"currentUsername"`
+	NewUsername     string `json:"newUsername"`
+}
+
+type usernameRequest struct {
+	Username string `json:"username"`
+}
+
+type setUserRolesRequest struct {
+	Username string   `json:"username"`
+	Roles    []string `json:"roles"`
+}
+
+func registerUserRoutes(r *Router, h *Handler) {
+	Register(r, "GET_USERBYNAME", Messages{"User retrieved", "Error getting user"}, h.getUserByName)
+	Register(r, "EDIT_USER", Messages{"User edited successfully", "Error editing user"}, h.editUser)
+	Register(r, "CREATE_USER", Messages{"User created successfully", "Error creating user"}, h.createUser)
+	Register(r, "DELETE_USER", Messages{"User deleted successfully", "Error deleting user"}, h.deleteUser)
+	Register(r, "SET_USER_ROLES", Messages{"User roles updated", "Error updating user roles"}, h.setUserRoles)
+}
+
+func (h *Handler) getUserByName(ctx context.Context, req getUserByNameRequest) (models.User, error) {
+	return h.service.GetByUser(ctx, req.Name)
+}
+
+func (h *Handler) editUser(ctx context.Context, req editUserRequest) (Empty, error) {
+	_, err := h.service.EditUser(ctx, req.CurrentUsername, req.NewUsername)
+	return Empty{}, err
+}
+
+func (h *Handler) createUser(ctx context.Context, req usernameRequest) (*models.User, error) {
+	if req.Username == "" {
+		return nil, &Error{Code: CodeBadRequest, Message: "Username is required"}
+	}
+	return h.service.CreateUser(ctx, req.Username)
+}
+
+func (h *Handler) deleteUser(ctx context.Context, req usernameRequest) (Empty, error) {
+	if err := h.requireSelfOrAdmin(ctx, req.Username); err != nil {
+		return Empty{}, err
+	}
+	return Empty{}, h.service.DeleteUser(ctx, req.Username)
+}
+
+func (h *Handler) setUserRoles(ctx context.Context, req setUserRolesRequest) (*models.User, error) {
+	for _, role := range req.Roles {
+		if role != models.RoleAdmin && role != models.RoleMerchant {
+			return nil, &Error{Code: CodeBadRequest, Message: fmt.Sprintf("Unknown role %q", role)}
+		}
+	}
+	return h.service.SetUserRoles(ctx, req.Username, req.Roles)
+}
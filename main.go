@@ -1,11 +1,20 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 
 	"github.com/FelipeGeraldoblufus/product-microservice-go/config"
+	"github.com/FelipeGeraldoblufus/product-microservice-go/controllers"
 	"github.com/FelipeGeraldoblufus/product-microservice-go/internal"
+	"github.com/FelipeGeraldoblufus/product-microservice-go/migrations"
 
 	"github.com/joho/godotenv"
 	amqp "github.com/rabbitmq/amqp091-go"
@@ -25,45 +34,173 @@ func getChannel() *amqp.Channel {
 	return ch
 }
 
+// Declara el exchange y la cola de mensajes muertos (DLX/DLQ)
+func declareDeadLetter(ch *amqp.Channel) error {
+	err := ch.ExchangeDeclare(
+		config.DeadLetterExchange(), // name
+		"direct",                    // type
+		true,                        // durable
+		false,                       // auto-deleted
+		false,                       // internal
+		false,                       // no-wait
+		nil,                         // arguments
+	)
+	if err != nil {
+		return fmt.Errorf("failed to declare the dead letter exchange: %w", err)
+	}
+
+	_, err = ch.QueueDeclare(
+		config.DeadLetterQueue(), // name
+		true,                     // durable
+		false,                    // delete when unused
+		false,                    // exclusive
+		false,                    // no-wait
+		nil,                      // arguments
+	)
+	if err != nil {
+		return fmt.Errorf("failed to declare the dead letter queue: %w", err)
+	}
+
+	err = ch.QueueBind(
+		config.DeadLetterQueue(),    // queue name
+		config.ProductQueue,         // routing key
+		config.DeadLetterExchange(), // exchange
+		false,                       // no-wait
+		nil,                         // arguments
+	)
+	if err != nil {
+		return fmt.Errorf("failed to bind the dead letter queue: %w", err)
+	}
+	return nil
+}
+
+// Declara la cola donde esperan los mensajes que se van a reintentar. Al vencer
+// su expiración RabbitMQ los devuelve a la cola principal por el exchange por defecto.
+func declareRetryQueue(ch *amqp.Channel) error {
+	_, err := ch.QueueDeclare(
+		config.RetryQueue(), // name
+		true,                // durable
+		false,               // delete when unused
+		false,               // exclusive
+		false,               // no-wait
+		amqp.Table{ // arguments
+			"x-dead-letter-exchange":    "",
+			"x-dead-letter-routing-key": config.ProductQueue,
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to declare the retry queue: %w", err)
+	}
+	return nil
+}
+
+// errQueueArguments indica que la cola ya existe con otros argumentos, por
+// ejemplo porque la declaró una versión sin DLQ
+var errQueueArguments = errors.New("queue already exists with different arguments")
+
 // Declara la cola si no existe
-func declareQueue(ch *amqp.Channel) amqp.Queue {
-	// Declarar la cola si no existe
+func declareQueue(ch *amqp.Channel) (amqp.Queue, error) {
+	// Declarar la cola si no existe. RabbitMQ no permite cambiar los argumentos
+	// de dead-letter de una cola existente y responde PRECONDITION_FAILED.
 	q, err := ch.QueueDeclare(
-		"product", // name
-		true,      // durable (la cola sobrevivirá a reinicios de RabbitMQ)
-		false,     // delete when unused (no se elimina automáticamente cuando está vacía)
-		false,     // exclusive
-		false,     // no-wait
-		nil,       // arguments
+		config.ProductQueue, // name
+		true,                // durable (la cola sobrevivirá a reinicios de RabbitMQ)
+		false,               // delete when unused (no se elimina automáticamente cuando está vacía)
+		false,               // exclusive
+		false,               // no-wait
+		amqp.Table{ // arguments
+			"x-dead-letter-exchange":    config.DeadLetterExchange(),
+			"x-dead-letter-routing-key": config.ProductQueue,
+		},
 	)
-	failOnError(err, "Failed to declare a queue")
-	return q
+	var amqpErr *amqp.Error
+	if errors.As(err, &amqpErr) && amqpErr.Code == amqp.PreconditionFailed {
+		return q, fmt.Errorf("%w: %s. Stop every instance, wait until %q is empty, delete it (rabbitmqctl delete_queue %s) and start the service again",
+			errQueueArguments, amqpErr.Reason, config.ProductQueue, config.ProductQueue)
+	}
+	if err != nil {
+		return q, fmt.Errorf("failed to declare a queue: %w", err)
+	}
+	return q, nil
 }
 
 // Establece la calidad de servicio (QoS) para el canal de RabbitMQ.
-func setQoS(ch *amqp.Channel) {
+func setQoS(ch *amqp.Channel) error {
 	err := ch.Qos(
-		1,     // prefetch count: Especifica cuántos mensajes puede recibir un consumidor antes de que se detenga la entrega. En este caso, se establece en 1.
-		0,     // prefetch size: No se usa en este caso, se establece como 0.
-		false, // global: Indica si estas configuraciones de QoS se aplican a nivel de canal o a nivel de conexión. En este caso, es a nivel de canal (false).
+		config.PrefetchCount(), // prefetch count: Especifica cuántos mensajes puede recibir un consumidor antes de que se detenga la entrega. Por defecto uno por worker.
+		0,                      // prefetch size: No se usa en este caso, se establece como 0.
+		false,                  // global: Indica si estas configuraciones de QoS se aplican a nivel de canal o a nivel de conexión. En este caso, es a nivel de canal (false).
 	)
-
-	failOnError(err, "Failed to set QoS")
+	if err != nil {
+		return fmt.Errorf("failed to set QoS: %w", err)
+	}
+	return nil
 }
 
+// Identificador del consumidor, necesario para cancelarlo al apagar el servicio
+const consumerTag = "product-ms"
+
 // Registra un consumidor para la cola dada y devuelve un canal de entrega de mensajes.
-func registerConsumer(ch *amqp.Channel, q amqp.Queue) <-chan amqp.Delivery {
+func registerConsumer(ch *amqp.Channel, q amqp.Queue) (<-chan amqp.Delivery, error) {
 	msgs, err := ch.Consume(
-		q.Name, // queue
-		"",     // consumer
-		false,  // auto-ack
-		false,  // exclusive
-		false,  // no-local
-		false,  // no-wait
-		nil,    // args
+		q.Name,      // queue
+		consumerTag, // consumer
+		false,       // auto-ack
+		false,       // exclusive
+		false,       // no-local
+		false,       // no-wait
+		nil,         // args
 	)
-	failOnError(err, "Failed to register a consumer")
-	return msgs
+	if err != nil {
+		return nil, fmt.Errorf("failed to register a consumer: %w", err)
+	}
+	return msgs, nil
+}
+
+// Declara las colas, aplica QoS y registra el consumidor sobre el canal. Se
+// llama al arrancar y después de cada reconexión con RabbitMQ.
+func setupConsumer(ch *amqp.Channel) (<-chan amqp.Delivery, error) {
+	// Declarar la cola de mensajes muertos
+	if err := declareDeadLetter(ch); err != nil {
+		return nil, err
+	}
+	// Declarar la cola de reintentos
+	if err := declareRetryQueue(ch); err != nil {
+		return nil, err
+	}
+	// Declarar la cola y obtener su estructura
+	q, err := declareQueue(ch)
+	if err != nil {
+		return nil, err
+	}
+	// Establecer la calidad de servicio en el canal
+	if err := setQoS(ch); err != nil {
+		return nil, err
+	}
+	// Registrar un consumidor para la cola
+	return registerConsumer(ch, q)
+}
+
+// Lanza los workers que procesan msgs. Terminan cuando msgs se cierra, ya sea
+// por cancelar el consumidor o por perder la conexión.
+//
+// Cada worker confirma sus mensajes al terminarlos, en cualquier orden. Es
+// seguro porque siempre se confirma con multiple=false: el ack solo afecta a
+// su propio delivery tag y nunca confirma mensajes anteriores que otro worker
+// sigue procesando. Si la conexión se cae, RabbitMQ reenvía exactamente los que
+// no se confirmaron. Las peticiones RPC son independientes entre sí, así que
+// tampoco hace falta procesarlas en el orden de llegada.
+func startWorkers(msgs <-chan amqp.Delivery, handler *internal.Handler, pub *internal.Publisher, workers int, wg *sync.WaitGroup) {
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for d := range msgs {
+				// Llamar al manejador de mensajes internos con el mensaje y el publicador de respuestas
+				handler.Handle(d, pub)
+			}
+		}()
+	}
 }
 
 func main() {
@@ -74,33 +211,127 @@ func main() {
 	godotenv.Load()
 	fmt.Println("Loaded env variables...")
 
+	// "product-ms migrate ..." gestiona el esquema de la base de datos y termina
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrate(os.Args[2:])
+		return
+	}
+
 	// Configurar la base de datos
 	config.SetupDatabase()
 	fmt.Println("Database connection configured...")
 
+	// No atender peticiones si falta aplicar alguna migración
+	failOnError(migrations.CheckCurrent(config.DB), fmt.Sprintf("Database schema is not up to date, run %q", os.Args[0]+" migrate up"))
+
 	// Configurar RabbitMQ
 	config.SetupRabbitMQ()
 	fmt.Println("RabbitMQ Connection configured...")
 
-	// Obtener canal de RabbitMQ
-	ch := getChannel()
-	// Declarar la cola y obtener su estructura
-	q := declareQueue(ch)
-	// Establecer la calidad de servicio en el canal
-	setQoS(ch)
-	// Registrar un consumidor para la cola
-	msgs := registerConsumer(ch, q)
+	msgs, err := setupConsumer(getChannel())
+	if errors.Is(err, errQueueArguments) {
+		// Pasa al actualizar desde una versión sin DLQ, ver env_example
+		log.Fatalf("Cannot declare queue %q: %v", config.ProductQueue, err)
+	}
+	failOnError(err, "Failed to set up consumer")
+
+	// Las respuestas se publican por un canal distinto al de consumo
+	pub := internal.NewPublisher(config.GetPublishChannel())
+
+	// Los productos y los usuarios se guardan en Postgres
+	service := controllers.NewService(controllers.NewGormRepositories(config.DB))
+	handler := internal.NewHandler(service)
+
+	// Iniciar el procesamiento de mensajes en varios goroutines
+	var wg sync.WaitGroup
+	workers := config.ConsumerWorkers()
+	startWorkers(msgs, handler, pub, workers, &wg)
 
-	// Iniciar el procesamiento de mensajes en un goroutine
-	var forever chan struct{}
+	// Iniciar la API REST
+	server := &http.Server{
+		Addr:    ":" + config.HTTPPort(),
+		Handler: internal.NewHTTPHandler(handler),
+	}
 	go func() {
-		for d := range msgs {
-			// Llamar al manejador de mensajes internos con el mensaje y el canal de RabbitMQ
-			internal.Handler(d, ch)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Panicf("Failed to start HTTP server: %s", err)
+		}
+	}()
+	log.Printf(" [*] HTTP API listening on %s", server.Addr)
+
+	// Esperar mensajes hasta recibir SIGINT o SIGTERM
+	log.Printf(" [*] Awaiting RPC requests with %d workers", workers)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Devolver al stock las reservas vencidas
+	go handler.ExpireReservations(ctx)
+	// Eliminar definitivamente los productos borrados hace más de PRODUCT_RETENTION
+	go handler.PurgeDeletedProducts(ctx)
+
+	for {
+		select {
+		case <-ctx.Done():
+			shutdown(server, &wg)
+			return
+		case amqpErr := <-config.NotifyClosed():
+			log.Printf("RabbitMQ connection lost: %v", amqpErr)
+		}
+
+		// Reconectar y volver a registrar el consumidor hasta lograrlo o recibir una señal
+		for ctx.Err() == nil {
+			if err := config.ReconnectRabbitMQ(ctx); err != nil {
+				break
+			}
+			msgs, err := setupConsumer(config.GetChannel())
+			if err != nil {
+				log.Printf("Failed to set up consumer after reconnecting: %v", err)
+				continue
+			}
+			pub.SetChannel(config.GetPublishChannel())
+			startWorkers(msgs, handler, pub, workers, &wg)
+			log.Printf(" [*] Consumer re-registered, awaiting RPC requests")
+			break
+		}
+	}
+}
+
+// Detiene el servidor HTTP y el consumidor, espera a que terminen las
+// peticiones en proceso (como máximo SHUTDOWN_TIMEOUT) y cierra RabbitMQ y la
+// base de datos.
+func shutdown(server *http.Server, wg *sync.WaitGroup) {
+	log.Println(" [*] Shutting down, draining in-flight messages...")
+
+	timeout := config.ShutdownTimeout()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("Failed to shut down HTTP server: %v", err)
+	}
+
+	// Al cancelar el consumidor RabbitMQ deja de entregar mensajes y msgs se cierra
+	if config.RabbitMQState() == config.StateConnected {
+		if err := config.GetChannel().Cancel(consumerTag, false); err != nil {
+			log.Printf("Failed to cancel consumer: %v", err)
 		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
 	}()
 
-	// Esperar indefinidamente a los mensajes
-	log.Printf(" [*] Awaiting RPC requests")
-	<-forever
-}
\ No newline at end of file
+	select {
+	case <-done:
+		log.Println(" [*] All in-flight messages processed")
+	case <-ctx.Done():
+		// Los mensajes sin confirmar serán reenviados por RabbitMQ a otra réplica
+		log.Printf(" [*] Drain timeout of %s exceeded, closing anyway", timeout)
+	}
+
+	config.CloseRabbitMQ()
+	config.CloseDatabase()
+	log.Println(" [*] Product MS stopped")
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/FelipeGeraldoblufus/product-microservice-go/config"
+	"github.com/FelipeGeraldoblufus/product-microservice-go/migrations"
+)
+
+func migrateUsage() {
+	fmt.Fprintf(os.Stderr, "usage: %s migrate up | down [steps] | status\n", os.Args[0])
+	os.Exit(2)
+}
+
+// runMigrate ejecuta el subcomando migrate: up aplica las migraciones
+// pendientes, down revierte las últimas (una por defecto) y status las lista.
+func runMigrate(args []string) {
+	if len(args) == 0 {
+		migrateUsage()
+	}
+
+	config.SetupDatabase()
+	defer config.CloseDatabase()
+
+	switch args[0] {
+	case "up":
+		applied, err := migrations.Up(config.DB)
+		failOnError(err, "Failed to apply migrations")
+		log.Printf("Applied %d migrations", applied)
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			var err error
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps <= 0 {
+				migrateUsage()
+			}
+		}
+		reverted, err := migrations.Down(config.DB, steps)
+		failOnError(err, "Failed to revert migrations")
+		log.Printf("Reverted %d migrations", reverted)
+
+	case "status":
+		states, err := migrations.Status(config.DB)
+		failOnError(err, "Failed to read migration status")
+		for _, state := range states {
+			status := "pending"
+			if state.AppliedAt != nil {
+				status = "applied " + state.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d  %-24s  %s\n", state.Version, state.Name, status)
+		}
+
+	default:
+		migrateUsage()
+	}
+}
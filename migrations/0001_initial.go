@@ -0,0 +1,27 @@
+package migrations
+
+// Esquema original, el que creaba AutoMigrate. IF NOT EXISTS permite adoptar
+// bases de datos creadas antes de las migraciones versionadas.
+var initialSchema = Migration{
+	Version: 1,
+	Name:    "initial",
+	Up: exec(
+		`CREATE TABLE IF NOT EXISTS products (
+			id bigserial PRIMARY KEY,
+			product_id text NOT NULL,
+			name text NOT NULL UNIQUE,
+			price bigint NOT NULL,
+			stock bigint NOT NULL,
+			description text NOT NULL,
+			category text NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS users (
+			id bigserial PRIMARY KEY,
+			username text NOT NULL UNIQUE
+		)`,
+	),
+	Down: exec(
+		"DROP TABLE IF EXISTS users",
+		"DROP TABLE IF EXISTS products",
+	),
+}
@@ -0,0 +1,8 @@
+package migrations
+
+var userRoles = Migration{
+	Version: 2,
+	Name:    "user_roles",
+	Up:      exec("ALTER TABLE users ADD COLUMN IF NOT EXISTS roles text NOT NULL DEFAULT ''"),
+	Down:    exec("ALTER TABLE users DROP COLUMN IF EXISTS roles"),
+}
@@ -0,0 +1,60 @@
+package migrations
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/FelipeGeraldoblufus/product-microservice-go/config"
+	"github.com/FelipeGeraldoblufus/product-microservice-go/models"
+	"gorm.io/gorm"
+)
+
+// Convierte la antigua columna price (unidades enteras sin moneda) en
+// price_minor y currency. Los precios existentes se consideran expresados en
+// DEFAULT_CURRENCY.
+var priceMinorUnits = Migration{
+	Version: 3,
+	Name:    "price_minor_units",
+	Up: func(tx *gorm.DB) error {
+		if !tx.Migrator().HasColumn("products", "price") {
+			return nil
+		}
+
+		currency := config.DefaultCurrency()
+		exponent, _ := models.CurrencyExponent(currency)
+		factor := int64(math.Pow10(exponent))
+
+		return exec(
+			"ALTER TABLE products ADD COLUMN IF NOT EXISTS price_minor bigint",
+			"ALTER TABLE products ADD COLUMN IF NOT EXISTS currency char(3)",
+			fmt.Sprintf("UPDATE products SET price_minor = price::bigint * %d, currency = '%s'", factor, currency),
+			"ALTER TABLE products ALTER COLUMN price_minor SET NOT NULL",
+			"ALTER TABLE products ALTER COLUMN currency SET NOT NULL",
+			"ALTER TABLE products DROP COLUMN price",
+		)(tx)
+	},
+	// Vuelve a unidades enteras según los decimales de la moneda de cada producto
+	Down: func(tx *gorm.DB) error {
+		if err := tx.Exec("ALTER TABLE products ADD COLUMN price bigint").Error; err != nil {
+			return err
+		}
+
+		var currencies []string
+		if err := tx.Raw("SELECT DISTINCT currency FROM products").Scan(&currencies).Error; err != nil {
+			return err
+		}
+		for _, currency := range currencies {
+			exponent, _ := models.CurrencyExponent(currency)
+			factor := int64(math.Pow10(exponent))
+			if err := tx.Exec("UPDATE products SET price = price_minor / ? WHERE currency = ?", factor, currency).Error; err != nil {
+				return err
+			}
+		}
+
+		return exec(
+			"ALTER TABLE products ALTER COLUMN price SET NOT NULL",
+			"ALTER TABLE products DROP COLUMN price_minor",
+			"ALTER TABLE products DROP COLUMN currency",
+		)(tx)
+	},
+}
@@ -0,0 +1,101 @@
+package migrations
+
+import (
+	"fmt"
+
+	"github.com/FelipeGeraldoblufus/product-microservice-go/models"
+	"gorm.io/gorm"
+)
+
+// Reemplaza el texto libre products.category por filas en la tabla categories
+// y la columna products.category_id. Crea una categoría por cada valor distinto.
+var categoryTable = Migration{
+	Version: 4,
+	Name:    "category_table",
+	Up: func(tx *gorm.DB) error {
+		err := exec(
+			`CREATE TABLE IF NOT EXISTS categories (
+				id bigserial PRIMARY KEY,
+				slug text NOT NULL,
+				name text NOT NULL,
+				parent_id bigint,
+				CONSTRAINT fk_categories_children FOREIGN KEY (parent_id) REFERENCES categories (id) ON DELETE RESTRICT
+			)`,
+			"CREATE UNIQUE INDEX IF NOT EXISTS idx_categories_slug ON categories (slug)",
+			"ALTER TABLE products ADD COLUMN IF NOT EXISTS category_id bigint",
+		)(tx)
+		if err != nil {
+			return err
+		}
+
+		if tx.Migrator().HasColumn("products", "category") {
+			var names []string
+			if err := tx.Raw("SELECT DISTINCT category FROM products").Scan(&names).Error; err != nil {
+				return err
+			}
+
+			for _, name := range names {
+				slug, err := uniqueCategorySlug(tx, models.Slugify(name))
+				if err != nil {
+					return err
+				}
+				category := models.Category{Name: name, Slug: slug}
+				if err := tx.Create(&category).Error; err != nil {
+					return err
+				}
+				if err := tx.Exec("UPDATE products SET category_id = ? WHERE category = ?", category.ID, name).Error; err != nil {
+					return err
+				}
+			}
+
+			if err := tx.Exec("ALTER TABLE products DROP COLUMN category").Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Exec("ALTER TABLE products ALTER COLUMN category_id SET NOT NULL").Error; err != nil {
+			return err
+		}
+		return addConstraint(tx, "products", "fk_products_category",
+			"FOREIGN KEY (category_id) REFERENCES categories (id) ON UPDATE CASCADE ON DELETE RESTRICT")
+	},
+	// Vuelve a guardar el nombre de la categoría en cada producto
+	Down: exec(
+		"ALTER TABLE products ADD COLUMN category text",
+		"UPDATE products SET category = categories.name FROM categories WHERE categories.id = products.category_id",
+		"ALTER TABLE products ALTER COLUMN category SET NOT NULL",
+		"ALTER TABLE products DROP COLUMN category_id",
+		"DROP TABLE categories",
+	),
+}
+
+// uniqueCategorySlug devuelve slug, o slug con un sufijo numérico si ya lo usa
+// otra categoría
+func uniqueCategorySlug(tx *gorm.DB, slug string) (string, error) {
+	if slug == "" {
+		slug = "uncategorized"
+	}
+
+	candidate := slug
+	for i := 2; ; i++ {
+		var count int64
+		if err := tx.Model(&models.Category{}).Where("slug = ?", candidate).Count(&count).Error; err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return candidate, nil
+		}
+		candidate = fmt.Sprintf("%s-%d", slug, i)
+	}
+}
+
+// addConstraint agrega la restricción si la tabla todavía no la tiene
+func addConstraint(tx *gorm.DB, table string, name string, definition string) error {
+	var count int64
+	err := tx.Raw("SELECT count(*) FROM pg_constraint WHERE conname = ? AND conrelid = ?::regclass", name, table).
+		Scan(&count).Error
+	if err != nil || count > 0 {
+		return err
+	}
+	return tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s %s", table, name, definition)).Error
+}
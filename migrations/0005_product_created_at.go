@@ -0,0 +1,8 @@
+package migrations
+
+var productCreatedAt = Migration{
+	Version: 5,
+	Name:    "product_created_at",
+	Up:      exec("ALTER TABLE products ADD COLUMN IF NOT EXISTS created_at timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP"),
+	Down:    exec("ALTER TABLE products DROP COLUMN IF EXISTS created_at"),
+}
@@ -0,0 +1,40 @@
+package migrations
+
+import (
+	"fmt"
+
+	"github.com/FelipeGeraldoblufus/product-microservice-go/config"
+	"gorm.io/gorm"
+)
+
+// Crea los índices GIN de búsqueda para el SEARCH_LANGUAGE vigente al migrar.
+// Si después se cambia el idioma la búsqueda sigue funcionando, pero sin índice.
+var productSearchIndex = Migration{
+	Version: 6,
+	Name:    "product_search_index",
+	Up: func(tx *gorm.DB) error {
+		language := config.SearchLanguage()
+		return exec(
+			fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_products_search_%s ON products USING GIN ((%s))",
+				language, config.ProductSearchVector(language)),
+			fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_categories_search_%s ON categories USING GIN ((%s))",
+				language, config.CategorySearchVector(language)),
+		)(tx)
+	},
+	// Borra los índices de todos los idiomas
+	Down: func(tx *gorm.DB) error {
+		var indexes []string
+		err := tx.Raw(`SELECT indexname FROM pg_indexes
+			WHERE indexname LIKE 'idx\_products\_search\_%' OR indexname LIKE 'idx\_categories\_search\_%'`).
+			Scan(&indexes).Error
+		if err != nil {
+			return err
+		}
+		for _, index := range indexes {
+			if err := tx.Exec(fmt.Sprintf("DROP INDEX IF EXISTS %q", index)).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
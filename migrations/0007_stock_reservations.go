@@ -0,0 +1,23 @@
+package migrations
+
+var stockReservations = Migration{
+	Version: 7,
+	Name:    "stock_reservations",
+	Up: exec(
+		`CREATE TABLE IF NOT EXISTS stock_reservations (
+			id bigserial PRIMARY KEY,
+			order_id text NOT NULL,
+			product_id bigint NOT NULL,
+			quantity bigint NOT NULL,
+			status text NOT NULL,
+			expires_at timestamptz NOT NULL,
+			created_at timestamptz,
+			updated_at timestamptz,
+			CONSTRAINT fk_stock_reservations_product FOREIGN KEY (product_id) REFERENCES products (id) ON DELETE RESTRICT
+		)`,
+		"CREATE UNIQUE INDEX IF NOT EXISTS idx_reservation_order_product ON stock_reservations (order_id, product_id)",
+		"CREATE INDEX IF NOT EXISTS idx_stock_reservations_status ON stock_reservations (status)",
+		"CREATE INDEX IF NOT EXISTS idx_stock_reservations_expires_at ON stock_reservations (expires_at)",
+	),
+	Down: exec("DROP TABLE IF EXISTS stock_reservations"),
+}
@@ -0,0 +1,22 @@
+package migrations
+
+var inventoryMovements = Migration{
+	Version: 8,
+	Name:    "inventory_movements",
+	Up: exec(
+		`CREATE TABLE IF NOT EXISTS inventory_movements (
+			id bigserial PRIMARY KEY,
+			product_id bigint NOT NULL,
+			delta bigint NOT NULL,
+			stock_after bigint NOT NULL,
+			source text NOT NULL,
+			reason text NOT NULL DEFAULT '',
+			reference text NOT NULL DEFAULT '',
+			created_at timestamptz NOT NULL,
+			CONSTRAINT fk_inventory_movements_product FOREIGN KEY (product_id) REFERENCES products (id) ON DELETE CASCADE
+		)`,
+		"CREATE INDEX IF NOT EXISTS idx_inventory_movements_product_id ON inventory_movements (product_id)",
+		"CREATE INDEX IF NOT EXISTS idx_inventory_movements_created_at ON inventory_movements (created_at)",
+	),
+	Down: exec("DROP TABLE IF EXISTS inventory_movements"),
+}
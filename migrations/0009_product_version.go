@@ -0,0 +1,8 @@
+package migrations
+
+var productVersion = Migration{
+	Version: 9,
+	Name:    "product_version",
+	Up:      exec("ALTER TABLE products ADD COLUMN IF NOT EXISTS version bigint NOT NULL DEFAULT 1"),
+	Down:    exec("ALTER TABLE products DROP COLUMN IF EXISTS version"),
+}
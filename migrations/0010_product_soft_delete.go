@@ -0,0 +1,28 @@
+package migrations
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+var productSoftDelete = Migration{
+	Version: 10,
+	Name:    "product_soft_delete",
+	Up: exec(
+		"ALTER TABLE products ADD COLUMN IF NOT EXISTS deleted_at timestamptz",
+		"CREATE INDEX IF NOT EXISTS idx_products_deleted_at ON products (deleted_at)",
+	),
+	// Sin la columna los productos borrados volverían a aparecer, así que antes
+	// hay que restaurarlos o purgarlos
+	Down: func(tx *gorm.DB) error {
+		var deleted int64
+		if err := tx.Raw("SELECT count(*) FROM products WHERE deleted_at IS NOT NULL").Scan(&deleted).Error; err != nil {
+			return err
+		}
+		if deleted > 0 {
+			return fmt.Errorf("%d products are soft-deleted, restore or purge them first", deleted)
+		}
+		return exec("ALTER TABLE products DROP COLUMN deleted_at")(tx)
+	},
+}
@@ -0,0 +1,42 @@
+package migrations
+
+import (
+	"log"
+
+	"github.com/FelipeGeraldoblufus/product-microservice-go/config"
+	"github.com/FelipeGeraldoblufus/product-microservice-go/models"
+	"gorm.io/gorm"
+)
+
+// Asigna un product_id nuevo a los productos sin product_id o con uno
+// repetido, conservando el del producto más antiguo de cada grupo, y crea el
+// índice único.
+var uniqueProductID = Migration{
+	Version: 11,
+	Name:    "unique_product_id",
+	Up: func(tx *gorm.DB) error {
+		var ids []uint
+		err := tx.Raw(`SELECT id FROM (
+			SELECT id, product_id, ROW_NUMBER() OVER (PARTITION BY product_id ORDER BY id) AS n FROM products
+		) p WHERE n > 1 OR product_id = ''`).Scan(&ids).Error
+		if err != nil {
+			return err
+		}
+
+		for _, id := range ids {
+			productID, err := models.NewProductID(config.ProductIDScheme())
+			if err != nil {
+				return err
+			}
+			if err := tx.Exec("UPDATE products SET product_id = ? WHERE id = ?", productID, id).Error; err != nil {
+				return err
+			}
+		}
+		if len(ids) > 0 {
+			log.Printf("Reassigned product_id of %d products", len(ids))
+		}
+
+		return tx.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_products_product_id ON products (product_id)").Error
+	},
+	Down: exec("DROP INDEX IF EXISTS idx_products_product_id"),
+}
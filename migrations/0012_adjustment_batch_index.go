@@ -0,0 +1,12 @@
+package migrations
+
+// Índice para encontrar los movimientos de un lote de ADJUST_STOCK_BULK por su
+// batch_id, que se guarda en reference
+var adjustmentBatchIndex = Migration{
+	Version: 12,
+	Name:    "adjustment_batch_index",
+	Up: exec(
+		"CREATE INDEX IF NOT EXISTS idx_inventory_movements_adjust_reference ON inventory_movements (reference) WHERE source = 'adjust' AND reference <> ''",
+	),
+	Down: exec("DROP INDEX IF EXISTS idx_inventory_movements_adjust_reference"),
+}
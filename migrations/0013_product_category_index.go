@@ -0,0 +1,10 @@
+package migrations
+
+// Índice para buscar los productos de una categoría, por ejemplo los de las
+// categorías que coinciden en SEARCH_PRODUCTS
+var productCategoryIndex = Migration{
+	Version: 13,
+	Name:    "product_category_index",
+	Up:      exec("CREATE INDEX IF NOT EXISTS idx_products_category_id ON products (category_id)"),
+	Down:    exec("DROP INDEX IF EXISTS idx_products_category_id"),
+}
@@ -0,0 +1,217 @@
+// Package migrations versiona el esquema de la base de datos. Cada migración
+// tiene un script de subida y otro de bajada; las aplicadas se registran en la
+// tabla schema_migrations.
+package migrations
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Migration es un cambio de esquema. Up y Down se ejecutan dentro de una transacción.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error
+}
+
+// Migraciones en orden. Las versiones nuevas se agregan al final y las ya
+// publicadas no se modifican.
+var all = []Migration{
+	initialSchema,
+	userRoles,
+	priceMinorUnits,
+	categoryTable,
+	productCreatedAt,
+	productSearchIndex,
+	stockReservations,
+	inventoryMovements,
+	productVersion,
+	productSoftDelete,
+	uniqueProductID,
+	adjustmentBatchIndex,
+	productCategoryIndex,
+}
+
+// ErrPending indica que hay migraciones sin aplicar
+var ErrPending = errors.New("pending migrations")
+
+// Clave del advisory lock que evita que dos réplicas migren a la vez
+const lockKey = "product-ms:schema_migrations"
+
+// State es una migración y, si se aplicó, cuándo
+type State struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+}
+
+type appliedMigration struct {
+	Version   int
+	Name      string
+	AppliedAt time.Time
+}
+
+func (appliedMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// exec devuelve un script que ejecuta las sentencias en orden
+func exec(statements ...string) func(tx *gorm.DB) error {
+	return func(tx *gorm.DB) error {
+		for _, statement := range statements {
+			if err := tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func createVersionTable(tx *gorm.DB) error {
+	return tx.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version bigint PRIMARY KEY,
+		name text NOT NULL,
+		applied_at timestamptz NOT NULL DEFAULT now()
+	)`).Error
+}
+
+// applied devuelve las migraciones aplicadas por versión
+func applied(tx *gorm.DB) (map[int]appliedMigration, error) {
+	var rows []appliedMigration
+	if err := tx.Order("version").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	versions := make(map[int]appliedMigration, len(rows))
+	for _, row := range rows {
+		versions[row.Version] = row
+	}
+	return versions, nil
+}
+
+// withLock ejecuta fn en una sola conexión que tiene el advisory lock de las
+// migraciones. Si otra réplica está migrando, espera a que termine.
+func withLock(db *gorm.DB, fn func(conn *gorm.DB) error) error {
+	return db.Connection(func(conn *gorm.DB) error {
+		if err := conn.Exec("SELECT pg_advisory_lock(hashtext(?))", lockKey).Error; err != nil {
+			return fmt.Errorf("failed to acquire migration lock: %w", err)
+		}
+		defer func() {
+			if err := conn.Exec("SELECT pg_advisory_unlock(hashtext(?))", lockKey).Error; err != nil {
+				log.Printf("Failed to release migration lock: %v", err)
+			}
+		}()
+
+		if err := createVersionTable(conn); err != nil {
+			return err
+		}
+		return fn(conn)
+	})
+}
+
+// Up aplica todas las migraciones pendientes y devuelve cuántas aplicó
+func Up(db *gorm.DB) (int, error) {
+	count := 0
+	err := withLock(db, func(conn *gorm.DB) error {
+		done, err := applied(conn)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range all {
+			if _, ok := done[m.Version]; ok {
+				continue
+			}
+			log.Printf("Applying migration %04d %s", m.Version, m.Name)
+			err := conn.Transaction(func(tx *gorm.DB) error {
+				if err := m.Up(tx); err != nil {
+					return err
+				}
+				return tx.Create(&appliedMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now()}).Error
+			})
+			if err != nil {
+				return fmt.Errorf("migration %04d %s failed: %w", m.Version, m.Name, err)
+			}
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+// Down revierte las últimas steps migraciones aplicadas y devuelve cuántas revirtió
+func Down(db *gorm.DB, steps int) (int, error) {
+	count := 0
+	err := withLock(db, func(conn *gorm.DB) error {
+		done, err := applied(conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(all) - 1; i >= 0 && count < steps; i-- {
+			m := all[i]
+			if _, ok := done[m.Version]; !ok {
+				continue
+			}
+			log.Printf("Reverting migration %04d %s", m.Version, m.Name)
+			err := conn.Transaction(func(tx *gorm.DB) error {
+				if err := m.Down(tx); err != nil {
+					return err
+				}
+				return tx.Delete(&appliedMigration{}, "version = ?", m.Version).Error
+			})
+			if err != nil {
+				return fmt.Errorf("reverting migration %04d %s failed: %w", m.Version, m.Name, err)
+			}
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+// Status devuelve todas las migraciones conocidas con su estado
+func Status(db *gorm.DB) ([]State, error) {
+	done := map[int]appliedMigration{}
+	if db.Migrator().HasTable(&appliedMigration{}) {
+		var err error
+		if done, err = applied(db); err != nil {
+			return nil, err
+		}
+	}
+
+	states := make([]State, len(all))
+	for i, m := range all {
+		states[i] = State{Version: m.Version, Name: m.Name}
+		if row, ok := done[m.Version]; ok {
+			appliedAt := row.AppliedAt
+			states[i].AppliedAt = &appliedAt
+		}
+	}
+	return states, nil
+}
+
+// CheckCurrent devuelve ErrPending si falta aplicar alguna migración. Se usa al
+// arrancar para no atender peticiones con un esquema desactualizado.
+func CheckCurrent(db *gorm.DB) error {
+	states, err := Status(db)
+	if err != nil {
+		return err
+	}
+
+	pending := 0
+	for _, state := range states {
+		if state.AppliedAt == nil {
+			pending++
+		}
+	}
+	if pending > 0 {
+		return fmt.Errorf("%w: %d of %d not applied", ErrPending, pending, len(states))
+	}
+	return nil
+}
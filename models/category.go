@@ -0,0 +1,37 @@
+package models
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Category agrupa productos. Las categorías forman un árbol mediante ParentID.
+type Category struct {
+	ID       uint       `gorm:"primaryKey" json:"id"`
+	Slug     string     `gorm:"not null;uniqueIndex" json:"slug"`
+	Name     string     `gorm:"not null" json:"name"`
+	ParentID *uint      `json:"parent_id"`
+	Children []Category `gorm:"foreignKey:ParentID;constraint:OnDelete:RESTRICT" json:"children,omitempty"`
+}
+
+// Slugify convierte un nombre en un identificador para URLs: "Ropa de Niños"
+// pasa a "ropa-de-ninos"
+func Slugify(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range norm.NFD.String(strings.ToLower(name)) {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+			// Se descartan los acentos separados por la normalización
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			b.WriteRune(r)
+			dash = false
+		case !dash && b.Len() > 0:
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+	return strings.TrimSuffix(b.String(), "-")
+}
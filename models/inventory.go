@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// Origen de un movimiento de inventario
+const (
+	MovementCreate  = "create"  // Stock inicial al crear el producto
+	MovementEdit    = "edit"    // Cambio de stock en EDIT_PRODUCT
+	MovementAdjust  = "adjust"  // Ajuste manual con ADJUST_STOCK_BULK
+	MovementReserve = "reserve" // Stock apartado para un pedido
+	MovementRelease = "release" // Reserva cancelada
+	MovementExpire  = "expire"  // Reserva vencida
+)
+
+// InventoryMovement registra un cambio en el stock de un producto
+type InventoryMovement struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	ProductID  uint      `gorm:"not null;index" json:"-"`
+	Product    Product   `gorm:"constraint:OnDelete:CASCADE" json:"-"`
+	Delta      int       `gorm:"not null" json:"delta"`
+	StockAfter int       `gorm:"not null" json:"stockAfter"`
+	Source     string    `gorm:"not null" json:"source"`
+	Reason     string    `gorm:"not null;default:''" json:"reason"`
+	Reference  string    `gorm:"not null;default:''" json:"reference"` // El pedido de una reserva o el lote de un ajuste
+	CreatedAt  time.Time `gorm:"not null;index" json:"created_at"`
+}
@@ -0,0 +1,49 @@
+package models
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Decimales de cada moneda ISO-4217 aceptada. Los precios se guardan en
+// unidades menores: 1999 USD son 19.99 dólares y 1999 CLP son 1999 pesos.
+var currencyExponents = map[string]int{
+	"ARS": 2,
+	"BRL": 2,
+	"CLP": 0,
+	"COP": 2,
+	"EUR": 2,
+	"GBP": 2,
+	"JPY": 0,
+	"MXN": 2,
+	"PEN": 2,
+	"USD": 2,
+	"UYU": 2,
+}
+
+// CurrencyExponent devuelve el número de decimales de la moneda y si es una moneda aceptada
+func CurrencyExponent(currency string) (int, bool) {
+	exponent, ok := currencyExponents[currency]
+	return exponent, ok
+}
+
+// FormatMinorUnits convierte un monto en unidades menores a decimal, por
+// ejemplo 1999 USD a "19.99"
+func FormatMinorUnits(amount int64, currency string) string {
+	exponent, _ := CurrencyExponent(currency)
+	if exponent == 0 {
+		return strconv.FormatInt(amount, 10)
+	}
+
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	digits := strconv.FormatInt(amount, 10)
+	if len(digits) <= exponent {
+		digits = strings.Repeat("0", exponent-len(digits)+1) + digits
+	}
+	split := len(digits) - exponent
+	return sign + digits[:split] + "." + digits[split:]
+}
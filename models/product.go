@@ -1,16 +1,44 @@
 package models
 
+import (
+	"encoding/json"
+	"time"
+
+	"gorm.io/gorm"
+)
+
 type Product struct {
-	ID          uint    `gorm:"primaryKey" json:"id"`
-	ProductID   string `gorm:"not null" json:"product_id"` 
-	Name        string  `gorm:"not null;unique" json:"name"`
-	Price       int `gorm:"not null" json:"price"`       // Cambia a float64 para representar precios
-	Stock       int     `gorm:"not null" json:"stock"`       // Entero para la cantidad en stock
-	Description string  `gorm:"not null" json:"description"`
-	Category string `gorm:"not null" json:"category"` // Texto descriptivo del producto
+	ID          uint           `gorm:"primaryKey" json:"id"`
+	ProductID   string         `gorm:"not null;uniqueIndex" json:"product_id"` // UUIDv7 o ULID según PRODUCT_ID_SCHEME
+	Name        string         `gorm:"not null;unique" json:"name"`
+	Price       int64          `gorm:"column:price_minor;not null" json:"price"` // Precio en unidades menores de Currency
+	Currency    string         `gorm:"type:char(3);not null" json:"currency"`    // Código ISO-4217
+	Stock       int            `gorm:"not null" json:"stock"`                    // Entero para la cantidad en stock
+	Description string         `gorm:"not null" json:"description"`
+	CategoryID  uint           `gorm:"not null" json:"category_id"`
+	Category    Category       `gorm:"constraint:OnUpdate:CASCADE,OnDelete:RESTRICT" json:"category"`
+	CreatedAt   time.Time      `gorm:"not null;default:CURRENT_TIMESTAMP" json:"created_at"`
+	Version     int            `gorm:"not null;default:1" json:"version"` // Aumenta con cada cambio, para detectar ediciones concurrentes
+	DeletedAt   gorm.DeletedAt `gorm:"index" json:"deleted_at"`           // Borrado lógico, ver PRODUCT_RETENTION. MarshalJSON lo omite si no está borrado
+}
+
+// MarshalJSON agrega el precio formateado como decimal junto al monto en
+// unidades menores. deleted_at solo aparece en los productos borrados.
+func (p Product) MarshalJSON() ([]byte, error) {
+	type product Product
+	var deletedAt *time.Time
+	if p.DeletedAt.Valid {
+		deletedAt = &p.DeletedAt.Time
+	}
+	return json.Marshal(struct {
+		product
+		PriceFormatted string     `json:"priceFormatted"`
+		DeletedAt      *time.Time `json:"deleted_at,omitempty"` // Reemplaza al campo del producto
+	}{product(p), FormatMinorUnits(p.Price, p.Currency), deletedAt})
 }
 
 type User struct {
-	ID       uint       `gorm:"primaryKey" json:"id"`
-	Username string     `gorm:"not null;unique" json:"username"`
+	ID       uint   `gorm:"primaryKey" json:"id"`
+	Username string `gorm:"not null;unique" json:"username"`
+	Roles    Roles  `gorm:"type:text;not null;default:''" json:"roles"` // Roles separados por comas, ver RoleAdmin y RoleMerchant
 }
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"crypto/rand"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/oklog/ulid/v2"
+)
+
+// Esquemas para generar Product.ProductID. Ambos se ordenan por fecha de creación.
+const (
+	ProductIDUUIDv7 = "uuidv7"
+	ProductIDULID   = "ulid"
+)
+
+// NewProductID genera un product_id con el esquema indicado
+func NewProductID(scheme string) (string, error) {
+	switch scheme {
+	case ProductIDUUIDv7:
+		id, err := uuid.NewV7()
+		if err != nil {
+			return "", err
+		}
+		return id.String(), nil
+	case ProductIDULID:
+		id, err := ulid.New(ulid.Now(), rand.Reader)
+		if err != nil {
+			return "", err
+		}
+		return id.String(), nil
+	default:
+		return "", fmt.Errorf("unknown product id scheme %q", scheme)
+	}
+}
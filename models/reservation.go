@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// Estados de una reserva de stock
+const (
+	ReservationReserved  = "reserved"  // Stock descontado, pendiente de confirmar
+	ReservationCommitted = "committed" // El pedido se confirmó, el stock no vuelve
+	ReservationReleased  = "released"  // El pedido se canceló y el stock se devolvió
+	ReservationExpired   = "expired"   // Venció el TTL y el stock se devolvió
+)
+
+// StockReservation es la cantidad de un producto apartada para un pedido.
+// Un pedido tiene una fila por producto.
+type StockReservation struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	OrderID   string    `gorm:"not null;uniqueIndex:idx_reservation_order_product" json:"order_id"`
+	ProductID uint      `gorm:"not null;uniqueIndex:idx_reservation_order_product" json:"-"`
+	Product   Product   `gorm:"constraint:OnDelete:RESTRICT" json:"-"`
+	Quantity  int       `gorm:"not null" json:"quantity"`
+	Status    string    `gorm:"not null;index" json:"status"`
+	ExpiresAt time.Time `gorm:"not null;index" json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
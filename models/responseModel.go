@@ -2,6 +2,7 @@ package models
 
 type Response struct {
 	Success string `json:"success"`
+	Code    string `json:"code,omitempty"` // Código de error legible por máquinas, vacío en respuestas exitosas
 	Message string `json:"message"`
 	Data    []byte `json:"data"`
 }
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strings"
+)
+
+// Roles reconocidos por las políticas de permisos
+const (
+	RoleAdmin    = "admin"
+	RoleMerchant = "merchant"
+)
+
+// Roles se guarda en la base de datos como texto separado por comas
+type Roles []string
+
+func (r Roles) Value() (driver.Value, error) {
+	return strings.Join(r, ","), nil
+}
+
+func (r *Roles) Scan(value interface{}) error {
+	var s string
+	switch v := value.(type) {
+	case nil:
+		s = ""
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	default:
+		return fmt.Errorf("cannot scan %T into Roles", value)
+	}
+
+	*r = nil
+	for _, role := range strings.Split(s, ",") {
+		if role = strings.TrimSpace(role); role != "" {
+			*r = append(*r, role)
+		}
+	}
+	return nil
+}
+
+// Has indica si role está entre los roles
+func (r Roles) Has(role string) bool {
+	for _, candidate := range r {
+		if candidate == role {
+			return true
+		}
+	}
+	return false
+}